@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/geoip"
+	"github.com/oceanheart/go-passport/internal/mail"
+	"github.com/oceanheart/go-passport/internal/metrics"
+	"github.com/oceanheart/go-passport/internal/repository"
+	"github.com/oceanheart/go-passport/internal/service"
+)
+
+// app holds the repositories and services shared by the server and the
+// admin commands, so both apply the same rules.
+type app struct {
+	geoIP *geoip.Reader
+
+	passwordService *auth.PasswordService
+	jwtService      *auth.JWTService
+	tokenSigner     *auth.TokenSigner
+	mailer          mail.Mailer
+
+	authCache   *repository.AuthCache
+	userRepo    *repository.UserRepository
+	sessionRepo *repository.SessionRepository
+
+	sessionEnricher      *service.SessionEnricher
+	passwordResetService *service.PasswordResetService
+	deviceAlertService   *service.DeviceAlertService
+	adminBootstrap       *service.AdminBootstrap
+	authService          *service.AuthService
+	userService          *service.UserService
+	sessionService       *service.SessionService
+}
+
+// newApp wires the services on top of db. appMetrics may be nil.
+func newApp(cfg *config.Config, db *config.Database, logger *slog.Logger, appMetrics *metrics.Metrics) (*app, error) {
+	// Open GeoIP database (optional)
+	geoIP, err := geoip.Open(cfg.GeoIPDatabasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &app{geoIP: geoIP}
+
+	a.passwordService = auth.NewPasswordService()
+	a.jwtService = auth.NewJWTService(cfg.SecretKeyBase, cfg.JWTIssuer)
+	a.tokenSigner = auth.NewTokenSigner(cfg.SecretKeyBase)
+
+	// Emails are logged unless SMTP is configured, which production requires
+	a.mailer = mail.NewLogMailer(logger)
+	if cfg.SMTPHost != "" {
+		a.mailer = mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+
+	// Writes publish cache invalidations, so changes made here reach the
+	// caches of running servers too
+	a.authCache = repository.NewAuthCache(cfg.AuthCacheSize, cfg.AuthCacheTTL)
+	a.userRepo = repository.NewUserRepository(db, a.authCache, logger)
+	a.sessionRepo = repository.NewSessionRepository(db, a.authCache, logger)
+
+	a.sessionEnricher = service.NewSessionEnricher(geoIP)
+	a.passwordResetService = service.NewPasswordResetService(a.userRepo, a.sessionRepo, db, a.passwordService, a.mailer, a.tokenSigner, cfg.AppURL, logger)
+	a.deviceAlertService = service.NewDeviceAlertService(a.userRepo, a.sessionRepo, db, a.passwordService, a.passwordResetService, a.mailer, a.tokenSigner, cfg.AppURL, cfg.NewDeviceAlerts, logger)
+	a.adminBootstrap = service.NewAdminBootstrap(a.userRepo, cfg.AdminEmails, cfg.AdminDemoteUnlisted, logger)
+	a.authService = service.NewAuthService(a.userRepo, a.sessionRepo, db, a.passwordService, a.jwtService, a.sessionEnricher, a.deviceAlertService, a.adminBootstrap, logger, appMetrics)
+	a.userService = service.NewUserService(a.userRepo, logger)
+	a.sessionService = service.NewSessionService(a.sessionRepo, a.userRepo, a.sessionEnricher, logger)
+
+	return a, nil
+}
+
+func (a *app) Close() error {
+	return a.geoIP.Close()
+}
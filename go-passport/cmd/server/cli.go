@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/oceanheart/go-passport/db/migrations"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/logging"
+	"github.com/oceanheart/go-passport/internal/models"
+)
+
+// errUsage makes a command print its usage and exit with status 2.
+var errUsage = errors.New("usage")
+
+// command is one "passport <group> <name>" subcommand. setup defines its
+// flags on a FlagSet of their own and returns the function that runs it,
+// which gets the parsed positional arguments and reads the flag values
+// setup's variables hold.
+type command struct {
+	name  string
+	args  string
+	help  string
+	setup func(fs *flag.FlagSet) runFunc
+}
+
+type runFunc func(ctx context.Context, cli *cli, args []string) error
+
+// noFlags is the setup of a command without flags of its own.
+func noFlags(run runFunc) func(fs *flag.FlagSet) runFunc {
+	return func(*flag.FlagSet) runFunc { return run }
+}
+
+// commandGroups are the administrative commands, by group name.
+var commandGroups = map[string][]command{
+	"migrate":  migrateCommands,
+	"user":     userCommands,
+	"sessions": sessionsCommands,
+	"token":    tokenCommands,
+}
+
+// cli is what admin commands get to work with. The configuration, database
+// and services are opened on first use, so commands that don't need them
+// (like "migrate new") work without a database.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	configPath     string
+
+	cfg      *config.Config
+	db       *config.Database
+	services *app
+	migrator *config.Migrator
+}
+
+// runCommandGroup implements "passport <group> <command> [flags] [args]"
+// and returns the exit code.
+func runCommandGroup(group string, commands []command, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	usage := func() {
+		fmt.Fprintf(stderr, "Usage:\n")
+		for _, c := range commands {
+			fmt.Fprintf(stderr, "  passport %s %s\n", group, strings.TrimSpace(c.name+" "+c.args))
+			fmt.Fprintf(stderr, "      %s\n", c.help)
+		}
+		fmt.Fprintf(stderr, "\nEvery command also takes --config; other settings come from the environment.\n")
+	}
+
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown %s command %q\n\n", group, args[0])
+		usage()
+		return 2
+	}
+
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet("passport "+group+" "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&c.configPath, "config", "", "YAML config file (or set "+config.ConfigFileEnv+")")
+	run := cmd.setup(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: passport %s %s [flags]\n  %s\n\nFlags:\n", group, strings.TrimSpace(cmd.name+" "+cmd.args), cmd.help)
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return 2
+	}
+	defer c.Close()
+
+	if err := run(context.Background(), c, positional); err != nil {
+		if errors.Is(err, errUsage) {
+			fs.Usage()
+			return 2
+		}
+		fmt.Fprintf(stderr, "passport %s %s: %v\n", group, cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses flags anywhere among the positional arguments,
+// so "user create alice@example.com --admin" works.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// Config loads the configuration like the server does.
+func (c *cli) Config() (*config.Config, error) {
+	if c.cfg != nil {
+		return c.cfg, nil
+	}
+
+	var args []string
+	if c.configPath != "" {
+		args = []string{"--config", c.configPath}
+	}
+	cfg, err := config.Load(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	c.cfg = cfg
+	return cfg, nil
+}
+
+// Services connects to the database and builds the services. Their logs go
+// to stderr as text.
+func (c *cli) Services() (*app, error) {
+	if c.services != nil {
+		return c.services, nil
+	}
+
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := logging.New(c.stderr, level, "text")
+	if err != nil {
+		return nil, err
+	}
+
+	c.db, err = config.NewDatabase(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	c.services, err = newApp(cfg, c.db, logger, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.migrator = config.NewMigrator(c.db, migrations.For(string(c.db.Dialect)), logger)
+	return c.services, nil
+}
+
+// Migrator returns a migrator for the embedded migrations.
+func (c *cli) Migrator() (*config.Migrator, error) {
+	if _, err := c.Services(); err != nil {
+		return nil, err
+	}
+	return c.migrator, nil
+}
+
+func (c *cli) Close() {
+	if c.services != nil {
+		c.services.Close()
+	}
+	if c.db != nil {
+		c.db.Close()
+	}
+}
+
+// findUser looks a user up by email address or numeric ID.
+func (c *cli) findUser(ctx context.Context, ref string) (*models.User, error) {
+	services, err := c.Services()
+	if err != nil {
+		return nil, err
+	}
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return services.userService.GetUserByID(ctx, id)
+	}
+	return services.userService.GetUserByEmail(ctx, ref)
+}
+
+// readSecret reads a password or token: with a prompt and without echo from
+// a terminal, or as the first line of piped input. Secrets aren't taken as
+// arguments, which would show up in process listings and shell history.
+func (c *cli) readSecret(prompt string) (string, error) {
+	if f, ok := c.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(c.stderr, prompt)
+		secret, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(c.stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", strings.ToLower(strings.TrimSuffix(prompt, ": ")), err)
+		}
+		return string(secret), nil
+	}
+
+	line, err := bufio.NewReader(c.stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read standard input: %w", err)
+	}
+	secret := strings.TrimRight(line, "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("no %s on standard input", strings.ToLower(strings.TrimSuffix(prompt, ": ")))
+	}
+	return secret, nil
+}
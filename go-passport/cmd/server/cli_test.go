@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/models"
+)
+
+const testSecretKeyBase = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// testCLI configures the commands for a new, migrated SQLite database.
+func testCLI(t *testing.T) {
+	t.Helper()
+	t.Setenv(config.ConfigFileEnv, "")
+	t.Setenv("DATABASE_URL", "sqlite:"+filepath.Join(t.TempDir(), "passport.db"))
+	t.Setenv("SECRET_KEY_BASE", testSecretKeyBase)
+	t.Setenv("LOG_LEVEL", "error")
+
+	if code, _, stderr := runCLI(t, "", "migrate", "up"); code != 0 {
+		t.Fatalf("migrate up exited with %d: %s", code, stderr)
+	}
+}
+
+// runCLI runs "passport args..." with stdin as its standard input.
+func runCLI(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = runCommandGroup(args[0], commandGroups[args[0]], args[1:], strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestUserCommands(t *testing.T) {
+	testCLI(t)
+	const password = "correct horse battery staple\n"
+
+	tests := []struct {
+		name     string
+		stdin    string
+		args     []string
+		wantCode int
+		want     string
+	}{
+		{"create admin", password, []string{"user", "create", "alice@example.com", "--admin"}, 0, "created admin alice@example.com (id 1)"},
+		// --admin doesn't carry over from the previous run
+		{"create user", password, []string{"user", "create", "bob@example.com"}, 0, "created user bob@example.com (id 2)"},
+		{"create duplicate", password, []string{"user", "create", "bob@example.com"}, 1, "passport user create:"},
+		{"create without password", "", []string{"user", "create", "carol@example.com"}, 1, "no password on standard input"},
+		{"create without email", password, []string{"user", "create"}, 2, "Usage: passport user create EMAIL"},
+		{"unknown command", "", []string{"user", "rename"}, 2, `unknown user command "rename"`},
+		{"promote", "", []string{"user", "promote", "2"}, 0, "bob@example.com is now admin"},
+		{"list", "", []string{"user", "list", "--search", "bob"}, 0, "bob@example.com"},
+		{"delete unconfirmed", "", []string{"user", "delete", "bob@example.com"}, 1, "refusing to delete without --yes"},
+		{"delete", "", []string{"user", "delete", "bob@example.com", "--yes"}, 0, "deleted bob@example.com (id 2)"},
+		{"delete missing", "", []string{"user", "delete", "bob@example.com", "--yes"}, 1, "passport user delete:"},
+		{"revoke sessions", "", []string{"sessions", "revoke-user", "alice@example.com"}, 0, "revoked 0 sessions for alice@example.com"},
+		{"purge sessions", "", []string{"sessions", "purge", "--older-than", "0s"}, 2, "Usage: passport sessions purge"},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, tt.stdin, tt.args...)
+		if code != tt.wantCode || !strings.Contains(stdout+stderr, tt.want) {
+			t.Errorf("%s: exited with %d, output %q; want %d and %q", tt.name, code, stdout+stderr, tt.wantCode, tt.want)
+		}
+	}
+}
+
+func TestTokenInspect(t *testing.T) {
+	testCLI(t)
+	if code, _, stderr := runCLI(t, "correct horse battery staple\n", "user", "create", "alice@example.com"); code != 0 {
+		t.Fatalf("user create exited with %d: %s", code, stderr)
+	}
+
+	token, err := auth.NewJWTService(testSecretKeyBase, "passport.oceanheart.ai").GenerateToken(&models.User{ID: 1, EmailAddress: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCLI(t, "Bearer "+token+"\n", "token", "inspect")
+	if code != 0 || !strings.Contains(stdout, "valid: yes") || !strings.Contains(stdout, "user: user alice@example.com (id 1)") {
+		t.Errorf("inspect exited with %d, output %q", code, stdout+stderr)
+	}
+
+	// Tokens aren't taken as arguments, where they'd show in process listings
+	if code, _, _ := runCLI(t, "", "token", "inspect", token); code != 2 {
+		t.Errorf("inspect with the token as an argument exited with %d, want 2", code)
+	}
+
+	if code, _, stderr := runCLI(t, "not-a-token\n", "token", "inspect"); code != 1 || !strings.Contains(stderr, "failed to decode token") {
+		t.Errorf("inspect of a malformed token exited with %d, output %q", code, stderr)
+	}
+}
+
+func TestMigrateNewUsesDialectDirectory(t *testing.T) {
+	testCLI(t)
+
+	root := t.TempDir()
+	for _, dir := range []string{"db/migrations", "db/migrations/sqlite"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	code, stdout, stderr := runCLI(t, "", "migrate", "new", "add_things")
+	if want := filepath.Join("db/migrations/sqlite", "001_add_things.up.sql"); code != 0 || !strings.Contains(stdout, want) {
+		t.Errorf("migrate new exited with %d, output %q; want %s", code, stdout+stderr, want)
+	}
+
+	code, stdout, stderr = runCLI(t, "", "migrate", "new", "add_things", "--dir", "db/migrations")
+	if want := filepath.Join("db/migrations", "001_add_things.up.sql"); code != 0 || !strings.Contains(stdout, want) {
+		t.Errorf("migrate new --dir exited with %d, output %q; want %s", code, stdout+stderr, want)
+	}
+}
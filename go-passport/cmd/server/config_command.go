@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/oceanheart/go-passport/internal/config"
+)
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage:
+  passport [serve] [flags]          Run the server
+  passport config check [flags]     Validate and print the effective configuration
+  passport config reference         Print every setting with its default (Markdown)
+  passport migrate <command>        Apply, revert, list or create migrations
+  passport user <command>           Create, promote, demote, reset, delete or list users
+  passport sessions <command>       Purge old sessions or revoke a user's sessions
+  passport token inspect            Decode and verify a JWT
+
+Run a command group without arguments for its commands and flags.
+
+Settings are read from defaults, a YAML file (--config or PASSPORT_CONFIG),
+environment variables and flags, each overriding the previous.
+
+Flags:
+`)
+	config.PrintFlags(w)
+}
+
+// runConfigCommand implements "passport config ..." and returns the exit
+// code.
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return 2
+	}
+
+	switch args[0] {
+	case "check":
+		return checkConfig(args[1:], stdout, stderr)
+	case "reference":
+		if err := config.WriteReference(stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown config command %q\n\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+}
+
+// checkConfig loads the configuration like the server would and prints the
+// effective values with their sources. Secrets are redacted.
+func checkConfig(args []string, stdout, stderr io.Writer) int {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage(stderr)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "configuration is invalid:\n%v\n", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tSOURCE\tVALUE")
+	for _, s := range cfg.Settings() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, s.Source, s.Value)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if cfg.ConfigFile != "" {
+		fmt.Fprintf(stdout, "\nconfig file: %s\n", cfg.ConfigFile)
+	}
+	fmt.Fprintln(stdout, "configuration is valid")
+	return 0
+}
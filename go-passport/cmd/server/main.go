@@ -2,92 +2,232 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 	
+	"github.com/oceanheart/go-passport/db/migrations"
 	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/clientip"
 	"github.com/oceanheart/go-passport/internal/config"
 	"github.com/oceanheart/go-passport/internal/handlers"
+	"github.com/oceanheart/go-passport/internal/health"
+	"github.com/oceanheart/go-passport/internal/logging"
+	"github.com/oceanheart/go-passport/internal/metrics"
 	"github.com/oceanheart/go-passport/internal/middleware"
 	"github.com/oceanheart/go-passport/internal/repository"
-	"github.com/oceanheart/go-passport/internal/service"
+	"github.com/oceanheart/go-passport/internal/tracing"
 )
 
+
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfigCommand(args[1:], os.Stdout, os.Stderr))
+	}
+	if len(args) > 0 {
+		if commands, ok := commandGroups[args[0]]; ok {
+			os.Exit(runCommandGroup(args[0], commands, args[1:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	}
+
+	serve(args)
+}
+
+// serve runs the HTTP server; args are configuration flags.
+func serve(args []string) {
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(slog.New(slog.NewJSONHandler(os.Stderr, nil)), "failed to load configuration", err)
+	}
+
+	// Set up structured logging; the standard log package is routed through
+	// it too, so stray log.Printf calls from dependencies stay JSON
+	level, err := logging.ParseLevel(cfg.LogLevel)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal(slog.New(slog.NewJSONHandler(os.Stderr, nil)), "failed to configure logging", err)
+	}
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(level)
+	logger, err := logging.New(os.Stdout, logLevel, cfg.LogFormat)
+	if err != nil {
+		fatal(slog.New(slog.NewJSONHandler(os.Stderr, nil)), "failed to configure logging", err)
+	}
+	slog.SetDefault(logger)
+
+	// Set up tracing; spans are flushed on shutdown
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracesExporter, cfg.ServiceName, cfg.Environment)
+	if err != nil {
+		fatal(logger, "failed to configure tracing", err)
 	}
 
 	// Connect to database
 	db, err := config.NewDatabase(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal(logger, "failed to connect to database", err)
 	}
 	defer db.Close()
 
 	// Run migrations if enabled
+	migrator := config.NewMigrator(db, migrations.For(string(db.Dialect)), logger)
 	if cfg.RunMigrations {
-		migrator := config.NewMigrator(db)
-		if err := migrator.Run(context.Background(), "db/migrations"); err != nil {
-			log.Fatalf("Failed to run migrations: %v", err)
+		if err := migrator.Up(context.Background()); err != nil {
+			fatal(logger, "failed to run migrations", err)
 		}
 	}
 
-	// Initialize services
-	passwordService := auth.NewPasswordService()
-	jwtService := auth.NewJWTService(cfg.SecretKeyBase, cfg.JWTIssuer)
+	// Prometheus metrics, including connection pool statistics
+	appMetrics := metrics.New(db.DB)
+
+	// Repositories and services
+	services, err := newApp(cfg, db, logger, appMetrics)
+	if err != nil {
+		fatal(logger, "failed to open GeoIP database", err)
+	}
+	defer services.Close()
+	if services.geoIP == nil {
+		logger.Info("GEOIP_DATABASE_PATH not set; session locations will not be recorded")
+	}
+	authCache := services.authCache
+	if authCache.Enabled() {
+		appMetrics.RegisterCache("users", authCache.UserStats)
+		appMetrics.RegisterCache("sessions", authCache.SessionStats)
+	}
 
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(db)
-	sessionRepo := repository.NewSessionRepository(db)
+	// Background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
 
-	// Initialize services
-	authService := service.NewAuthService(userRepo, sessionRepo, passwordService, jwtService)
-	userService := service.NewUserService(userRepo)
-	sessionService := service.NewSessionService(sessionRepo, userRepo)
+	// Evict cached users/sessions changed by other instances. SQLite is
+	// used by a single instance, so there is nothing to listen to.
+	var invalidationListener *repository.InvalidationListener
+	if authCache.Enabled() && db.Dialect == config.Postgres {
+		invalidationListener = repository.NewInvalidationListener(cfg.DatabaseURL, authCache, logger)
+		go invalidationListener.Run(workerCtx)
+	}
+
+	// Apply ADMIN_EMAILS to existing accounts, and make sure production can
+	// be administered
+	if err := services.adminBootstrap.Sync(context.Background()); err != nil {
+		fatal(logger, "failed to apply ADMIN_EMAILS", err)
+	}
+	if cfg.IsProduction() {
+		if err := services.adminBootstrap.RequireAdmin(context.Background()); err != nil {
+			fatal(logger, "refusing to start without an admin", err)
+		}
+	}
 
 	// Load templates
-	templates, err := loadTemplates()
+	templates, err := handlers.LoadTemplates("web/templates")
 	if err != nil {
-		log.Fatalf("Failed to load templates: %v", err)
+		fatal(logger, "failed to load templates", err)
 	}
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(authService, userService, cfg, templates)
-	apiHandler := handlers.NewAPIHandler(authService, userService, cfg)
-	adminHandler := handlers.NewAdminHandler(userService, sessionService, cfg, templates)
+	redirectSanitizer := auth.NewRedirectSanitizer(cfg.ReturnToAllowedHosts, !cfg.CookieSecure)
+	authHandler := handlers.NewAuthHandler(services.authService, services.userService, services.sessionService, redirectSanitizer, cfg, templates)
+	apiHandler := handlers.NewAPIHandler(services.authService, services.userService, cfg)
+	adminHandler := handlers.NewAdminHandler(services.userService, services.sessionService, cfg, templates)
+	cspReportHandler := handlers.NewCSPReportHandler(logger)
+	securityHandler := handlers.NewSecurityHandler(services.deviceAlertService, services.passwordResetService, cfg, templates, logger)
+
+	// Readiness checks
+	readinessChecks := []health.Check{
+		{Name: "database", Run: db.PingContext},
+		{Name: "migrations", Run: func(ctx context.Context) error {
+			pending, err := migrator.Pending(ctx)
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("%d pending migrations: %v", len(pending), pending)
+			}
+			return nil
+		}},
+	}
+	if invalidationListener != nil {
+		readinessChecks = append(readinessChecks, health.Check{Name: "cache_invalidation", Run: func(ctx context.Context) error {
+			if !invalidationListener.Connected() {
+				return errors.New("cache invalidation listener is not connected")
+			}
+			return nil
+		}})
+	}
+	healthChecker := health.NewChecker(cfg.HealthCheckTimeout, logger, readinessChecks...)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService, jwtService)
+	clientIPResolver, err := clientip.NewResolver(cfg.TrustedProxies, cfg.ClientIPHeader)
+	if err != nil {
+		fatal(logger, "failed to parse trusted proxies", err)
+	}
+	authMiddleware := middleware.NewAuthMiddleware(services.authService, services.jwtService, appMetrics)
 	csrfMiddleware := middleware.NewCSRFMiddleware(cfg.CSRFSecret)
-	rateLimiter := middleware.NewRateLimiter(cfg.RateLimitSignIn, cfg.RateLimitSignInWindow)
+	securityHeaders := middleware.NewSecurityHeadersMiddleware(cfg)
+	apiCORS, err := middleware.NewCORSMiddleware(apiCORSPolicy(cfg))
+	if err != nil {
+		fatal(logger, "failed to configure CORS", err)
+	}
+	var rateLimitStore middleware.RateLimitStore
+	if cfg.RateLimitStore == "postgres" {
+		store := middleware.NewPostgresRateLimitStore(db, logger)
+		go store.Cleanup(workerCtx)
+		rateLimitStore = store
+	} else {
+		store := middleware.NewMemoryRateLimitStore()
+		go store.Cleanup(workerCtx)
+		rateLimitStore = store
+	}
+	rateLimitPolicies, err := middleware.ParseRateLimitPolicies(cfg.RateLimitPolicies)
+	if err != nil {
+		fatal(logger, "failed to parse rate limit policies", err)
+	}
+	rateLimiter := middleware.NewRateLimiter(rateLimitStore, rateLimitPolicies, logger, appMetrics)
 
 	// Setup router
 	r := chi.NewRouter()
 
 	// Global middleware
 	r.Use(chimw.RequestID)
-	r.Use(middleware.Logging)
-	r.Use(middleware.Recovery)
+	r.Use(middleware.ResolveClientIP(clientIPResolver))
+	r.Use(middleware.Tracing)
+	r.Use(middleware.Logging(logger))
+	r.Use(middleware.Recovery(logger))
+	r.Use(appMetrics.Instrument)
+	r.Use(securityHeaders.Apply)
 	r.Use(chimw.Compress(5))
 
-	// Health check
+	// Health checks (/up is kept for existing probes)
 	r.Get("/up", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	r.Get("/livez", healthChecker.Livez)
+	r.Get("/readyz", healthChecker.Readyz)
+
+	// Metrics on the main port only when protected by a token
+	if cfg.MetricsAddr == "" && cfg.MetricsToken != "" {
+		r.With(middleware.RequireBearerToken(cfg.MetricsToken)).Handle("/metrics", appMetrics.Handler())
+	}
+
+	// CSP violation reports (posted by browsers, no CSRF token)
+	r.Post("/csp-report", rateLimiter.LimitEndpoint("csp_report")(cspReportHandler.Report))
 
 	// Static files
 	r.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static/"))))
@@ -102,10 +242,16 @@ func main() {
 		r.Get("/sign_in", authHandler.SignInPage)
 		r.Post("/sign_in", rateLimiter.LimitEndpoint("sign_in")(authHandler.SignIn))
 		r.Get("/sign_up", authHandler.SignUpPage)
-		r.Post("/sign_up", authHandler.SignUp)
+		r.Post("/sign_up", rateLimiter.LimitEndpoint("sign_up")(authHandler.SignUp))
 		r.Post("/sign_out", authHandler.SignOut)
 		r.Delete("/sign_out", authHandler.SignOut)
 
+		// Security email links
+		r.Get("/sessions/not_me", securityHandler.NotMePage)
+		r.Post("/sessions/not_me", rateLimiter.LimitEndpoint("password_reset")(securityHandler.NotMe))
+		r.Get("/password/reset", securityHandler.PasswordResetPage)
+		r.Post("/password/reset", rateLimiter.LimitEndpoint("password_reset")(securityHandler.ResetPassword))
+
 		// Admin routes
 		r.Route("/admin", func(r chi.Router) {
 			r.Use(authMiddleware.RequireAdmin)
@@ -120,17 +266,19 @@ func main() {
 
 	// API routes (no CSRF protection)
 	r.Route("/api/auth", func(r chi.Router) {
+		r.Use(apiCORS.Handle)
 		r.Use(authMiddleware.ExtractAuth)
+		r.Use(csrfMiddleware.ProtectAPI(apiCORS))
 
 		// Public API routes
-		r.Post("/signin", rateLimiter.LimitEndpoint("api_signin")(apiHandler.SignIn))
+		r.Post("/signin", rateLimiter.LimitEndpoint("sign_in")(apiHandler.SignIn))
 		r.Delete("/signout", apiHandler.SignOut)
 
 		// Protected API routes
 		r.Group(func(r chi.Router) {
 			r.Use(authMiddleware.RequireAuth)
 			r.Post("/verify", apiHandler.Verify)
-			r.Post("/refresh", apiHandler.Refresh)
+			r.Post("/refresh", rateLimiter.LimitEndpoint("refresh")(apiHandler.Refresh))
 			r.Get("/user", apiHandler.CurrentUser)
 		})
 	})
@@ -146,57 +294,91 @@ func main() {
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Starting server on port %s", cfg.Port)
+		logger.Info("starting server", "port", cfg.Port, "environment", cfg.Environment)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+			fatal(logger, "server failed to start", err)
 		}
 	}()
 
+	// Metrics server on a separate (internal) port
+	var metricsServer *http.Server
+	if cfg.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", appMetrics.Handler())
+		metricsServer = &http.Server{
+			Addr:         cfg.MetricsAddr,
+			Handler:      metricsMux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+
+		go func() {
+			logger.Info("starting metrics server", "addr", cfg.MetricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal(logger, "metrics server failed to start", err)
+			}
+		}()
+	}
+
+	// Apply configuration changes on SIGHUP (and when the config file changes)
+	configReloader := &reloader{
+		args:            args,
+		current:         cfg,
+		logger:          logger,
+		logLevel:        logLevel,
+		rateLimiter:     rateLimiter,
+		cors:            apiCORS,
+		redirects:       redirectSanitizer,
+		securityHeaders: securityHeaders,
+		admins:          services.adminBootstrap,
+	}
+	go configReloader.Watch(workerCtx, cfg.ConfigFile, cfg.ConfigWatchInterval)
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	logger.Info("shutting down server", "drain_delay", cfg.ShutdownDrainDelay)
+
+	// Fail readiness first so load balancers stop sending new requests
+	healthChecker.SetShuttingDown()
+	time.Sleep(cfg.ShutdownDrainDelay)
+	stopWorkers()
 
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		logger.Error("server forced to shutdown", "error", err)
 	}
-
-	log.Println("Server exited")
-}
-
-func loadTemplates() (*template.Template, error) {
-	templateDir := "web/templates"
-	
-	// Find all template files
-	var templateFiles []string
-	err := filepath.Walk(templateDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			logger.Error("metrics server forced to shutdown", "error", err)
 		}
-		if !info.IsDir() && filepath.Ext(path) == ".html" {
-			templateFiles = append(templateFiles, path)
-		}
-		return nil
-	})
-	
-	if err != nil {
-		return nil, fmt.Errorf("failed to walk template directory: %w", err)
 	}
 
-	if len(templateFiles) == 0 {
-		return nil, fmt.Errorf("no template files found in %s", templateDir)
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("failed to flush traces", "error", err)
 	}
 
-	// Parse all templates
-	tmpl, err := template.ParseFiles(templateFiles...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	logger.Info("server exited")
+}
+
+// apiCORSPolicy is the CORS policy of the /api/auth routes.
+func apiCORSPolicy(cfg *config.Config) middleware.CORSPolicy {
+	return middleware.CORSPolicy{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           cfg.CORSMaxAge,
 	}
+}
 
-	return tmpl, nil
-}
\ No newline at end of file
+// fatal logs err and exits. Like log.Fatal, deferred calls don't run.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
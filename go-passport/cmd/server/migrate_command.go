@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/config"
+)
+
+var migrateCommands = []command{
+	{
+		name: "up",
+		help: "Apply all pending migrations",
+		setup: noFlags(func(ctx context.Context, c *cli, args []string) error {
+			if len(args) != 0 {
+				return errUsage
+			}
+			migrator, err := c.Migrator()
+			if err != nil {
+				return err
+			}
+			if err := migrator.Up(ctx); err != nil {
+				return err
+			}
+			return printMigrationStatus(ctx, c, migrator)
+		}),
+	},
+	{
+		name: "down",
+		help: "Revert the most recently applied migrations",
+		setup: func(fs *flag.FlagSet) runFunc {
+			steps := fs.Int("steps", 1, "Number of migrations to revert")
+
+			return func(ctx context.Context, c *cli, args []string) error {
+				if len(args) != 0 || *steps < 1 {
+					return errUsage
+				}
+				migrator, err := c.Migrator()
+				if err != nil {
+					return err
+				}
+				if err := migrator.Down(ctx, *steps); err != nil {
+					return err
+				}
+				return printMigrationStatus(ctx, c, migrator)
+			}
+		},
+	},
+	{
+		name: "to",
+		args: "VERSION",
+		help: "Apply or revert migrations until VERSION is the latest applied (0 reverts all)",
+		setup: noFlags(func(ctx context.Context, c *cli, args []string) error {
+			if len(args) != 1 {
+				return errUsage
+			}
+			version, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil || version < 0 {
+				return fmt.Errorf("invalid version %q", args[0])
+			}
+			migrator, err := c.Migrator()
+			if err != nil {
+				return err
+			}
+			if err := migrator.To(ctx, version); err != nil {
+				return err
+			}
+			return printMigrationStatus(ctx, c, migrator)
+		}),
+	},
+	{
+		name: "status",
+		help: "List migrations and whether they have been applied",
+		setup: noFlags(func(ctx context.Context, c *cli, args []string) error {
+			if len(args) != 0 {
+				return errUsage
+			}
+			migrator, err := c.Migrator()
+			if err != nil {
+				return err
+			}
+			return printMigrationStatus(ctx, c, migrator)
+		}),
+	},
+	{
+		name: "new",
+		args: "NAME",
+		help: "Create empty up and down files for a new migration",
+		setup: func(fs *flag.FlagSet) runFunc {
+			dir := fs.String("dir", "", "Migrations directory (default: db/migrations, or db/migrations/sqlite if DATABASE_URL is SQLite)")
+
+			return func(ctx context.Context, c *cli, args []string) error {
+				if len(args) != 1 {
+					return errUsage
+				}
+				if *dir == "" {
+					cfg, err := c.Config()
+					if err != nil {
+						return err
+					}
+					dialect, _, err := config.ParseDatabaseURL(cfg.DatabaseURL)
+					if err != nil {
+						return err
+					}
+					*dir = migrationsDir(dialect)
+				}
+
+				upPath, downPath, err := config.CreateMigration(*dir, args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(c.stdout, "created %s\ncreated %s\n", upPath, downPath)
+				return nil
+			}
+		},
+	},
+}
+
+// migrationsDir is where the migrations for dialect are kept in the source
+// tree, as embedded by package migrations.
+func migrationsDir(dialect config.Dialect) string {
+	if dialect == config.SQLite {
+		return "db/migrations/sqlite"
+	}
+	return "db/migrations"
+}
+
+func printMigrationStatus(ctx context.Context, c *cli, migrator *config.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", ""
+		if status.Applied {
+			state, appliedAt = "applied", status.AppliedAt.Local().Format(time.DateTime)
+		}
+		if status.Modified {
+			state = "modified"
+		}
+		if status.Down == "" {
+			state += " (irreversible)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	return tw.Flush()
+}
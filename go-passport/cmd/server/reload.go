@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/logging"
+	"github.com/oceanheart/go-passport/internal/middleware"
+	"github.com/oceanheart/go-passport/internal/service"
+)
+
+// reloader re-runs configuration loading and swaps the runtime values of
+// the components consuming reloadable settings. A reload is applied as a
+// whole or not at all: if the new configuration is invalid the running one
+// is kept.
+type reloader struct {
+	args            []string
+	current         *config.Config
+	logger          *slog.Logger
+	logLevel        *slog.LevelVar
+	rateLimiter     *middleware.RateLimiter
+	cors            *middleware.CORSMiddleware
+	redirects       *auth.RedirectSanitizer
+	securityHeaders *middleware.SecurityHeadersMiddleware
+	admins          *service.AdminBootstrap
+
+	mu sync.Mutex
+}
+
+// Reload loads the configuration again and applies the reloadable settings
+// that changed. Changes to other settings are logged but need a restart.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := config.Load(r.args)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	changed, restart := r.current.Changes(next)
+	if len(restart) > 0 {
+		r.logger.Warn("configuration changes need a restart to take effect", "settings", restart)
+	}
+	if len(changed) == 0 {
+		r.logger.Info("configuration reloaded, no runtime changes")
+		return nil
+	}
+
+	cfg := r.current.WithReloadable(next)
+
+	// Everything that can fail goes before the first swap
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	policies, err := middleware.ParseRateLimitPolicies(cfg.RateLimitPolicies)
+	if err != nil {
+		return fmt.Errorf("failed to parse rate limit policies: %w", err)
+	}
+	if err := r.cors.Update(apiCORSPolicy(cfg)); err != nil {
+		return fmt.Errorf("failed to configure CORS: %w", err)
+	}
+
+	r.rateLimiter.SetPolicies(policies)
+	r.redirects.SetAllowedHosts(cfg.ReturnToAllowedHosts)
+	r.securityHeaders.Update(cfg)
+	r.logLevel.Set(level)
+	r.admins.SetPolicy(cfg.AdminEmails, cfg.AdminDemoteUnlisted)
+	r.current = cfg
+
+	r.logger.Info("configuration reloaded", "changed", changed)
+
+	// The new configuration is in effect either way; a failure here only
+	// means some accounts keep their old role until the next reload
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := r.admins.Sync(ctx); err != nil {
+		r.logger.Error("failed to apply ADMIN_EMAILS", "error", err)
+	}
+	return nil
+}
+
+// Watch reloads on SIGHUP, and when configFile changes if interval is set,
+// until ctx is done.
+func (r *reloader) Watch(ctx context.Context, configFile string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	var lastMod time.Time
+	if configFile != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+		lastMod = modTime(configFile)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("reloading configuration", "trigger", "SIGHUP")
+		case <-tick:
+			mod := modTime(configFile)
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			r.logger.Info("reloading configuration", "trigger", "file", "config_file", configFile)
+		}
+
+		if err := r.Reload(); err != nil {
+			r.logger.Error("configuration reload rejected, keeping the current configuration", "error", err)
+		}
+	}
+}
+
+// modTime returns the file's modification time, or the zero time if it
+// can't be read (a reload then reports the error).
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/oceanheart/go-passport/internal/service"
+)
+
+var sessionsCommands = []command{
+	{
+		name: "purge",
+		help: "Delete sessions older than --older-than",
+		setup: func(fs *flag.FlagSet) runFunc {
+			olderThan := fs.Duration("older-than", service.SessionMaxAge, "Delete sessions created longer ago than this")
+
+			return func(ctx context.Context, c *cli, args []string) error {
+				if len(args) != 0 || *olderThan <= 0 {
+					return errUsage
+				}
+				services, err := c.Services()
+				if err != nil {
+					return err
+				}
+				deleted, err := services.sessionService.PurgeSessions(ctx, *olderThan)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(c.stdout, "deleted %d sessions\n", deleted)
+				return nil
+			}
+		},
+	},
+	{
+		name: "revoke-user",
+		args: "EMAIL|ID",
+		help: "Sign a user out of every session",
+		setup: noFlags(func(ctx context.Context, c *cli, args []string) error {
+			if len(args) != 1 {
+				return errUsage
+			}
+			user, err := c.findUser(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			count, err := c.services.sessionService.CountUserSessions(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			if err := c.services.sessionService.DeleteUserSessions(ctx, user.ID); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.stdout, "revoked %d sessions for %s\n", count, user.EmailAddress)
+			return nil
+		}),
+	},
+}
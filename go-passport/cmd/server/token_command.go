@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var tokenCommands = []command{
+	{
+		name: "inspect",
+		help: "Decode a JWT read from the terminal or standard input and check its signature, expiry and user",
+		setup: noFlags(func(ctx context.Context, c *cli, args []string) error {
+			if len(args) != 0 {
+				return errUsage
+			}
+			tokenString, err := c.readSecret("Token: ")
+			if err != nil {
+				return err
+			}
+			tokenString = strings.TrimPrefix(strings.TrimSpace(tokenString), "Bearer ")
+
+			// Decode first so malformed or foreign tokens can still be read
+			claims := jwt.MapClaims{}
+			token, _, err := jwt.NewParser().ParseUnverified(tokenString, claims)
+			if err != nil {
+				return fmt.Errorf("failed to decode token: %w", err)
+			}
+			header, err := json.MarshalIndent(token.Header, "", "  ")
+			if err != nil {
+				return err
+			}
+			body, err := json.MarshalIndent(claims, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.stdout, "header: %s\nclaims: %s\n", header, body)
+
+			services, err := c.Services()
+			if err != nil {
+				return err
+			}
+			validated, err := services.authService.ValidateToken(tokenString)
+			if err != nil {
+				fmt.Fprintf(c.stdout, "valid: no (%v)\n", err)
+				return nil
+			}
+			fmt.Fprintln(c.stdout, "valid: yes")
+			if validated.ExpiresAt != nil {
+				fmt.Fprintf(c.stdout, "expires: %s\n", validated.ExpiresAt.Local().Format(time.DateTime))
+			}
+
+			user, err := services.authService.GetUserFromClaims(ctx, validated)
+			if err != nil {
+				fmt.Fprintf(c.stdout, "user: %v\n", err)
+				return nil
+			}
+			fmt.Fprintf(c.stdout, "user: %s %s (id %d)\n", user.Role, user.EmailAddress, user.ID)
+			return nil
+		}),
+	},
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/models"
+)
+
+var userCommands = []command{
+	{
+		name: "create",
+		args: "EMAIL",
+		help: "Create an account; the password is read from the terminal or standard input",
+		setup: func(fs *flag.FlagSet) runFunc {
+			admin := fs.Bool("admin", false, "Create the account as an administrator")
+
+			return func(ctx context.Context, c *cli, args []string) error {
+				if len(args) != 1 {
+					return errUsage
+				}
+				services, err := c.Services()
+				if err != nil {
+					return err
+				}
+				password, err := c.readSecret("Password: ")
+				if err != nil {
+					return err
+				}
+
+				role := models.RoleUser
+				if *admin {
+					role = models.RoleAdmin
+				}
+				user, err := services.authService.CreateUser(ctx, models.UserCreateParams{
+					EmailAddress: args[0],
+					Password:     password,
+				}, role)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(c.stdout, "created %s %s (id %d)\n", user.Role, user.EmailAddress, user.ID)
+				return nil
+			}
+		},
+	},
+	{
+		name: "promote",
+		args: "EMAIL|ID",
+		help: "Make a user an administrator",
+		setup: noFlags(func(ctx context.Context, c *cli, args []string) error {
+			return setRole(ctx, c, args, models.RoleAdmin)
+		}),
+	},
+	{
+		name: "demote",
+		args: "EMAIL|ID",
+		help: "Make an administrator a regular user",
+		setup: noFlags(func(ctx context.Context, c *cli, args []string) error {
+			return setRole(ctx, c, args, models.RoleUser)
+		}),
+	},
+	{
+		name: "reset-password",
+		args: "EMAIL|ID",
+		help: "Set a new password read from the terminal or standard input, signing the user out everywhere",
+		setup: func(fs *flag.FlagSet) runFunc {
+			sendEmail := fs.Bool("send-email", false, "Email a password reset link instead")
+
+			return func(ctx context.Context, c *cli, args []string) error {
+				if len(args) != 1 {
+					return errUsage
+				}
+				user, err := c.findUser(ctx, args[0])
+				if err != nil {
+					return err
+				}
+
+				if *sendEmail {
+					if err := c.services.passwordResetService.SendResetEmail(ctx, user); err != nil {
+						return err
+					}
+					fmt.Fprintf(c.stdout, "sent a password reset link to %s\n", user.EmailAddress)
+					return nil
+				}
+
+				password, err := c.readSecret("New password: ")
+				if err != nil {
+					return err
+				}
+				if err := c.services.authService.SetPassword(ctx, user.ID, password); err != nil {
+					return err
+				}
+				fmt.Fprintf(c.stdout, "password changed for %s; all sessions signed out\n", user.EmailAddress)
+				return nil
+			}
+		},
+	},
+	{
+		name: "delete",
+		args: "EMAIL|ID",
+		help: "Delete a user and their sessions",
+		setup: func(fs *flag.FlagSet) runFunc {
+			confirm := fs.Bool("yes", false, "Confirm the deletion")
+
+			return func(ctx context.Context, c *cli, args []string) error {
+				if len(args) != 1 {
+					return errUsage
+				}
+				if !*confirm {
+					return errors.New("refusing to delete without --yes")
+				}
+				user, err := c.findUser(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				if err := c.services.userService.DeleteUser(ctx, user.ID); err != nil {
+					return err
+				}
+				fmt.Fprintf(c.stdout, "deleted %s (id %d)\n", user.EmailAddress, user.ID)
+				return nil
+			}
+		},
+	},
+	{
+		name: "list",
+		help: "List users, newest first",
+		setup: func(fs *flag.FlagSet) runFunc {
+			search := fs.String("search", "", "Only list users whose email contains this")
+			page := fs.Int("page", 1, "Page number")
+			perPage := fs.Int("per-page", 50, "Users per page")
+
+			return func(ctx context.Context, c *cli, args []string) error {
+				if len(args) != 0 || *page < 1 || *perPage < 1 {
+					return errUsage
+				}
+				services, err := c.Services()
+				if err != nil {
+					return err
+				}
+
+				var users []*models.User
+				var total int64 = -1
+				if *search != "" {
+					users, err = services.userService.SearchUsers(ctx, *search, *page, *perPage)
+				} else {
+					users, total, err = services.userService.ListUsers(ctx, *page, *perPage)
+				}
+				if err != nil {
+					return err
+				}
+
+				tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "ID\tEMAIL\tROLE\tCREATED")
+				for _, user := range users {
+					fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", user.ID, user.EmailAddress, user.Role, user.CreatedAt.Local().Format(time.DateTime))
+				}
+				if err := tw.Flush(); err != nil {
+					return err
+				}
+				if total >= 0 {
+					fmt.Fprintf(c.stdout, "\n%d of %d users (page %d)\n", len(users), total, *page)
+				}
+				return nil
+			}
+		},
+	},
+}
+
+func setRole(ctx context.Context, c *cli, args []string, role models.UserRole) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	user, err := c.findUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	user, err = c.services.userService.SetUserRole(ctx, user.ID, role)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "%s is now %s\n", user.EmailAddress, user.Role)
+	return nil
+}
@@ -0,0 +1,6 @@
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS browser,
+    DROP COLUMN IF EXISTS os,
+    DROP COLUMN IF EXISTS device_type,
+    DROP COLUMN IF EXISTS country,
+    DROP COLUMN IF EXISTS city;
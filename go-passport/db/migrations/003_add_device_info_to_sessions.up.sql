@@ -0,0 +1,7 @@
+-- Add parsed user agent and GeoIP details to sessions
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS browser VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS os VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS device_type VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS country VARCHAR(2) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS city VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+-- Create rate limit state shared by all instances. UNLOGGED: losing it on
+-- a crash only resets counters, and it avoids WAL traffic on every sign-in.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    tat TIMESTAMPTZ NOT NULL,
+    allowed BOOLEAN NOT NULL DEFAULT true
+);
+
+-- Create index on tat for cleanup queries
+CREATE INDEX IF NOT EXISTS idx_rate_limits_tat ON rate_limits(tat);
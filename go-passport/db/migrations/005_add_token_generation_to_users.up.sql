@@ -0,0 +1,3 @@
+-- Add a counter embedded in issued JWTs; raising it revokes a user's tokens
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS token_generation BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,35 @@
+// Package migrations embeds the SQL migrations so the binary doesn't depend
+// on the working directory. Files are named NNN_name.up.sql and
+// NNN_name.down.sql; see config.Migrator. Postgres migrations are in this
+// directory and SQLite ones in sqlite/.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql sqlite/*.sql
+var files embed.FS
+
+// FS holds the Postgres migrations.
+var FS = mustSub(".")
+
+// SQLite holds the SQLite migrations.
+var SQLite = mustSub("sqlite")
+
+// For returns the migrations for a dialect: "postgres" or "sqlite".
+func For(dialect string) fs.FS {
+	if dialect == "sqlite" {
+		return SQLite
+	}
+	return FS
+}
+
+func mustSub(dir string) fs.FS {
+	sub, err := fs.Sub(files, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
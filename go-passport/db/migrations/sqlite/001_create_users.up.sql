@@ -0,0 +1,10 @@
+-- Create users table. Emails are stored lower-cased; NOCASE keeps the
+-- uniqueness check case-insensitive regardless.
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email_address TEXT NOT NULL COLLATE NOCASE UNIQUE,
+    password_digest TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- Add a counter embedded in issued JWTs; raising it revokes a user's tokens
+ALTER TABLE users ADD COLUMN token_generation INTEGER NOT NULL DEFAULT 0;
@@ -25,6 +25,9 @@ type JWTService struct {
 type Claims struct {
 	UserID int64  `json:"userId"`
 	Email  string `json:"email"`
+	// Generation is the user's token generation when the token was issued;
+	// tokens from an earlier generation have been revoked
+	Generation int64 `json:"gen,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -46,8 +49,9 @@ func (s *JWTService) GenerateToken(user *models.User) (string, error) {
 	expiresAt := now.Add(7 * 24 * time.Hour) // 1 week expiration
 
 	claims := Claims{
-		UserID: user.ID,
-		Email:  user.EmailAddress,
+		UserID:     user.ID,
+		Email:      user.EmailAddress,
+		Generation: user.TokenGeneration,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    s.issuer,
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -125,8 +129,9 @@ func (s *JWTService) RefreshToken(claims *Claims) (string, error) {
 	expiresAt := now.Add(7 * 24 * time.Hour) // 1 week expiration
 
 	newClaims := Claims{
-		UserID: claims.UserID,
-		Email:  claims.Email,
+		UserID:     claims.UserID,
+		Email:      claims.Email,
+		Generation: claims.Generation,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    s.issuer,
 			IssuedAt:  jwt.NewNumericDate(now),
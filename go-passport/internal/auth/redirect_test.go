@@ -0,0 +1,38 @@
+package auth
+
+import "testing"
+
+func TestRedirectSanitizer(t *testing.T) {
+	s := NewRedirectSanitizer([]string{"oceanheart.ai", "*.oceanheart.ai"}, false)
+
+	tests := map[string]string{
+		"":                                   "",
+		"/dashboard?tab=1":                   "/dashboard?tab=1",
+		"https://watson.oceanheart.ai/notes": "https://watson.oceanheart.ai/notes",
+		"https://oceanheart.ai":              "https://oceanheart.ai",
+		"https://a.b.oceanheart.ai:8443/x":   "https://a.b.oceanheart.ai:8443/x",
+		"http://watson.oceanheart.ai":        "",
+		"https://evil.com":                   "",
+		"https://evil-oceanheart.ai":         "",
+		"https://oceanheart.ai.evil.com":     "",
+		"https://oceanheart.ai@evil.com":     "",
+		"https://user@watson.oceanheart.ai":  "",
+		"//evil.com":                         "",
+		"/\\evil.com":                        "",
+		"\\\\evil.com":                       "",
+		"/\t/evil.com":                       "",
+		"javascript:alert(1)":                "",
+		"dashboard":                          "",
+		"https:evil.com":                     "",
+	}
+	for target, want := range tests {
+		if got := s.Sanitize(target); got != want {
+			t.Errorf("Sanitize(%q) = %q, want %q", target, got, want)
+		}
+	}
+
+	dev := NewRedirectSanitizer([]string{"*.lvh.me", "localhost"}, true)
+	if got := dev.Sanitize("http://localhost:3000/cb"); got != "http://localhost:3000/cb" {
+		t.Errorf("dev Sanitize(localhost) = %q", got)
+	}
+}
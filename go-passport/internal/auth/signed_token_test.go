@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenSignerRoundTrip(t *testing.T) {
+	signer := NewTokenSigner("secret")
+	token := signer.Sign("password-reset", "42:abc", time.Hour)
+
+	subject, err := signer.Verify("password-reset", token)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if subject != "42:abc" {
+		t.Errorf("subject = %q, want %q", subject, "42:abc")
+	}
+}
+
+func TestTokenSignerRejectsOtherPurpose(t *testing.T) {
+	signer := NewTokenSigner("secret")
+	token := signer.Sign("password-reset", "42", time.Hour)
+
+	if _, err := signer.Verify("session-not-me", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestTokenSignerRejectsTampering(t *testing.T) {
+	signer := NewTokenSigner("secret")
+	token := signer.Sign("password-reset", "42", time.Hour)
+
+	if _, err := NewTokenSigner("other").Verify("password-reset", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("wrong key: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := signer.Verify("password-reset", "x"+token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("modified payload: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestTokenSignerExpiry(t *testing.T) {
+	signer := NewTokenSigner("secret")
+	token := signer.Sign("password-reset", "42", -time.Minute)
+
+	if _, err := signer.Verify("password-reset", token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("err = %v, want ErrTokenExpired", err)
+	}
+}
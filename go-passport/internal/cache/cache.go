@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// loadTimeout bounds a shared load, which no longer stops when the caller
+// that started it goes away.
+const loadTimeout = 10 * time.Second
+
+// Stats is a snapshot of a cache's counters.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+// Cache is a bounded, thread-safe LRU cache whose entries expire after a
+// fixed TTL. Concurrent loads of the same missing key are collapsed into a
+// single call to the loader.
+//
+// A nil *Cache is valid and behaves as a cache that never holds anything,
+// which lets callers disable caching without extra branches.
+type Cache[K comparable, V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	ll         *list.List
+	items      map[K]*list.Element
+	generation uint64
+
+	group singleflight.Group
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func New[K comparable, V any](maxEntries int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[K]*list.Element),
+	}
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return zero, false
+	}
+
+	e := elem.Value.(*entry[K, V])
+	if time.Now().After(e.expiresAt) {
+		c.removeElement(elem)
+		c.misses.Add(1)
+		return zero, false
+	}
+
+	c.ll.MoveToFront(elem)
+	c.hits.Add(1)
+	return e.value, true
+}
+
+func (c *Cache[K, V]) Set(key K, value V) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value)
+}
+
+func (c *Cache[K, V]) set(key K, value V) {
+	expiresAt := time.Now().Add(c.ttl)
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		e.value = value
+		e.expiresAt = expiresAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// GetOrLoad returns the cached value for key, calling load on a miss. Only
+// one load per key runs at a time; concurrent callers share its result.
+// Errors are returned to every waiting caller and are not cached. The shared
+// load keeps ctx's values but not its cancellation, so one caller giving up
+// doesn't fail the others; each caller stops waiting when its own ctx is
+// done.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, load func(ctx context.Context) (V, error)) (V, error) {
+	if c == nil {
+		return load(ctx)
+	}
+
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	results := c.group.DoChan(fmt.Sprint(key), func() (interface{}, error) {
+		c.mu.Lock()
+		generation := c.generation
+		c.mu.Unlock()
+
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		value, err := load(loadCtx)
+		if err != nil {
+			return value, err
+		}
+
+		// Don't store the value if an invalidation happened while it was
+		// loading; it may already be stale.
+		c.mu.Lock()
+		if c.generation == generation {
+			c.set(key, value)
+		}
+		c.mu.Unlock()
+
+		return value, nil
+	})
+
+	var zero V
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return zero, result.Err
+		}
+		return result.Val.(V), nil
+	}
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// DeleteFunc removes every entry for which match returns true.
+func (c *Cache[K, V]) DeleteFunc(match func(key K, value V) bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for elem := c.ll.Front(); elem != nil; {
+		next := elem.Next()
+		e := elem.Value.(*entry[K, V])
+		if match(e.key, e.value) {
+			c.removeElement(elem)
+		}
+		elem = next
+	}
+}
+
+func (c *Cache[K, V]) Purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.ll.Init()
+	c.items = make(map[K]*list.Element)
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	c.mu.Lock()
+	size := c.ll.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+	}
+}
+
+func (c *Cache[K, V]) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[int, string](2, time.Minute)
+	c.Set(1, "one")
+	c.Set(2, "two")
+	c.Get(1)
+	c.Set(3, "three")
+
+	if _, ok := c.Get(2); ok {
+		t.Error("expected key 2 to be evicted")
+	}
+	if v, ok := c.Get(1); !ok || v != "one" {
+		t.Errorf("Get(1) = %q, %v; want one, true", v, ok)
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Errorf("stats = %+v, want 1 eviction and size 2", stats)
+	}
+}
+
+func TestCacheExpiresEntries(t *testing.T) {
+	c := New[int, string](10, time.Millisecond)
+	c.Set(1, "one")
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get(1); ok {
+		t.Error("expected entry to expire")
+	}
+}
+
+func TestCacheGetOrLoadDeduplicatesConcurrentLoads(t *testing.T) {
+	c := New[int, string](10, time.Minute)
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.GetOrLoad(context.Background(), 1, func(ctx context.Context) (string, error) {
+				calls.Add(1)
+				<-release
+				return "one", nil
+			})
+			if err != nil || v != "one" {
+				t.Errorf("GetOrLoad = %q, %v", v, err)
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+}
+
+func TestCacheGetOrLoadSurvivesCancelledCaller(t *testing.T) {
+	c := New[int, string](10, time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+	load := func(ctx context.Context) (string, error) {
+		close(started)
+		select {
+		case <-release:
+			return "one", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	// The first caller starts the load, then gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.GetOrLoad(ctx, 1, load)
+		first <- err
+	}()
+	<-started
+
+	second := make(chan string)
+	go func() {
+		v, err := c.GetOrLoad(context.Background(), 1, func(ctx context.Context) (string, error) {
+			t.Error("second caller ran its own load")
+			return "", nil
+		})
+		if err != nil {
+			t.Errorf("second GetOrLoad error = %v", err)
+		}
+		second <- v
+	}()
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled GetOrLoad error = %v, want context.Canceled", err)
+	}
+	close(release)
+	if v := <-second; v != "one" {
+		t.Errorf("second GetOrLoad = %q, want one", v)
+	}
+}
+
+func TestCacheGetOrLoadDoesNotCacheErrors(t *testing.T) {
+	c := New[int, string](10, time.Minute)
+	errBoom := errors.New("boom")
+
+	if _, err := c.GetOrLoad(context.Background(), 1, func(ctx context.Context) (string, error) {
+		return "", errBoom
+	}); !errors.Is(err, errBoom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	if _, ok := c.Get(1); ok {
+		t.Error("error result was cached")
+	}
+}
+
+func TestCacheDeleteDuringLoadSkipsStaleValue(t *testing.T) {
+	c := New[int, string](10, time.Minute)
+
+	c.GetOrLoad(context.Background(), 1, func(ctx context.Context) (string, error) {
+		c.Delete(1)
+		return "stale", nil
+	})
+
+	if _, ok := c.Get(1); ok {
+		t.Error("value loaded before invalidation was cached")
+	}
+}
+
+func TestNilCacheIsUsable(t *testing.T) {
+	var c *Cache[int, string]
+	c.Set(1, "one")
+	c.Delete(1)
+
+	if _, ok := c.Get(1); ok {
+		t.Error("nil cache returned a value")
+	}
+	v, err := c.GetOrLoad(context.Background(), 1, func(ctx context.Context) (string, error) {
+		return "loaded", nil
+	})
+	if err != nil || v != "loaded" {
+		t.Errorf("GetOrLoad = %q, %v", v, err)
+	}
+}
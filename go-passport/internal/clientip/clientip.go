@@ -0,0 +1,158 @@
+// Package clientip resolves the originating client address of a request
+// that may have passed through reverse proxies.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Forwarding headers a Resolver can read the client IP from.
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+// Resolver determines client IPs, honouring a forwarding header only when
+// it was added by a trusted proxy. The zero Resolver trusts no proxies and
+// always uses the connection's remote address.
+type Resolver struct {
+	trusted []netip.Prefix
+	header  string
+}
+
+// NewResolver builds a Resolver trusting the given proxies. Each entry is
+// a CIDR ("10.0.0.0/8") or a single address ("203.0.113.7"). header is the
+// one forwarding header the proxies maintain; the others are ignored, since
+// a proxy passes them on from the client untouched.
+func NewResolver(trustedProxies []string, header string) (*Resolver, error) {
+	switch header {
+	case HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP:
+	default:
+		return nil, fmt.Errorf("unsupported client IP header %q", header)
+	}
+
+	r := &Resolver{header: header}
+	for _, entry := range trustedProxies {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			r.trusted = append(r.trusted, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return r, nil
+}
+
+// Resolve returns the client IP for req, or "" if the remote address isn't
+// an IP (e.g. a unix socket).
+//
+// When the peer is a trusted proxy, the resolver's header is read. X-Real-IP
+// holds the client set by the proxy. X-Forwarded-For and Forwarded (RFC
+// 7239) are walked from right to left: each hop was appended by the proxy
+// before it, so the first untrusted address is the client. Entries to the
+// left of that were supplied by the client and are ignored.
+func (r *Resolver) Resolve(req *http.Request) string {
+	remote := parseAddr(req.RemoteAddr)
+	if !remote.IsValid() {
+		return ""
+	}
+	if !r.isTrusted(remote) {
+		return remote.String()
+	}
+
+	var hops []netip.Addr
+	switch r.header {
+	case HeaderForwarded:
+		hops = forwardedFor(req.Header)
+	case HeaderXForwardedFor:
+		hops = xForwardedFor(req.Header)
+	case HeaderXRealIP:
+		if realIP := parseAddr(req.Header.Get(HeaderXRealIP)); realIP.IsValid() {
+			return realIP.String()
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		// Unknown or obfuscated hops hide everything beyond them
+		if !hops[i].IsValid() {
+			break
+		}
+		client = hops[i]
+		if !r.isTrusted(client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the for= values of the Forwarded header in order.
+func forwardedFor(h http.Header) []netip.Addr {
+	var hops []netip.Addr
+	for _, value := range h.Values(HeaderForwarded) {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(name, "for") {
+					continue
+				}
+				hops = append(hops, parseAddr(strings.Trim(val, `"`)))
+			}
+		}
+	}
+	return hops
+}
+
+// xForwardedFor returns the X-Forwarded-For addresses in order.
+func xForwardedFor(h http.Header) []netip.Addr {
+	var hops []netip.Addr
+	for _, value := range h.Values(HeaderXForwardedFor) {
+		for _, entry := range strings.Split(value, ",") {
+			hops = append(hops, parseAddr(strings.TrimSpace(entry)))
+		}
+	}
+	return hops
+}
+
+// parseAddr accepts "ip", "ip:port", "[ipv6]" and "[ipv6]:port". It
+// returns the zero Addr for anything else.
+func parseAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap().WithZone("")
+}
@@ -0,0 +1,58 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.0.2.1"}
+
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", HeaderXForwardedFor, "198.51.100.4:5000", nil, "198.51.100.4"},
+		{"untrusted peer ignores XFF", HeaderXForwardedFor, "198.51.100.4:5000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "198.51.100.4"},
+		{"trusted peer", HeaderXForwardedFor, "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"spoofed left entries", HeaderXForwardedFor, "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.9, 10.1.1.1"}, "203.0.113.9"},
+		{"all trusted", HeaderXForwardedFor, "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "10.9.9.9, 192.0.2.1"}, "10.9.9.9"},
+		{"garbage hop", HeaderXForwardedFor, "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "203.0.113.9, nonsense"}, "10.0.0.2"},
+		{"client Forwarded ignored", HeaderXForwardedFor, "10.0.0.2:5000", map[string]string{"Forwarded": "for=1.2.3.4", "X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"client X-Real-IP ignored", HeaderXForwardedFor, "10.0.0.2:5000", map[string]string{"X-Real-IP": "1.2.3.4"}, "10.0.0.2"},
+		{"forwarded", HeaderForwarded, "10.0.0.2:5000", map[string]string{"Forwarded": `for=1.2.3.4, for="[2001:db8::1]:4711";proto=https`}, "2001:db8::1"},
+		{"client XFF ignored", HeaderForwarded, "10.0.0.2:5000", map[string]string{"Forwarded": "for=203.0.113.9", "X-Forwarded-For": "1.2.3.4"}, "203.0.113.9"},
+		{"x-real-ip", HeaderXRealIP, "192.0.2.1:5000", map[string]string{"X-Real-IP": "203.0.113.9"}, "203.0.113.9"},
+		{"ipv4-mapped peer", HeaderXForwardedFor, "[::ffff:198.51.100.4]:5000", nil, "198.51.100.4"},
+		{"non-ip peer", HeaderXForwardedFor, "@", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := NewResolver(trusted, tt.header)
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := resolver.Resolve(req); got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResolverRejectsInvalid(t *testing.T) {
+	if _, err := NewResolver([]string{"not-an-ip"}, HeaderXForwardedFor); err == nil {
+		t.Error("NewResolver() error = nil, want error")
+	}
+	if _, err := NewResolver(nil, "True-Client-IP"); err == nil {
+		t.Error("NewResolver(unsupported header) error = nil, want error")
+	}
+}
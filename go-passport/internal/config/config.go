@@ -1,16 +1,16 @@
 package config
 
 import (
-	"fmt"
-	"os"
-	"strconv"
 	"time"
 )
 
+// Config is the resolved configuration; see settings.go for the variables,
+// defaults and descriptions of its fields, and Load for how it's resolved.
 type Config struct {
 	// Server configuration
 	Port        string
 	Environment string
+	AppURL      string
 
 	// Database configuration
 	DatabaseURL string
@@ -23,112 +23,91 @@ type Config struct {
 	CookieDomain string
 	CookieSecure bool
 	
+	// Security headers configuration (HSTSMaxAge of 0 disables HSTS)
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	CSPReportOnly         bool
+	CSPReportURI          string
+	FrameAncestors        string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+	
+	// CORS configuration for the /api/auth routes (exact origins or
+	// wildcard subdomains like https://*.oceanheart.ai)
+	CORSAllowedOrigins []string
+	CORSMaxAge         time.Duration
+	
+	// Hosts return_to may redirect to after sign-in/out (exact hosts or
+	// wildcard subdomains like *.oceanheart.ai); local paths are always allowed
+	ReturnToAllowedHosts []string
+	
 	// JWT configuration
 	JWTIssuer string
 	
-	// Rate limiting configuration
+	// Auth cache configuration (AuthCacheTTL of 0 disables the cache)
+	AuthCacheSize int
+	AuthCacheTTL  time.Duration
+	
+	// Proxies whose forwarding header is trusted (CIDRs or addresses), and
+	// which header they maintain
+	TrustedProxies []string
+	ClientIPHeader string
+	
+	// Rate limiting configuration (RateLimitStore is "memory" or "postgres";
+	// RateLimitPolicies uses the syntax of middleware.ParseRateLimitPolicies)
+	RateLimitStore         string
 	RateLimitSignIn        int
 	RateLimitSignInWindow  time.Duration
+	RateLimitPolicies      string
 	
-	// Admin configuration
-	AdminEmails []string
+	// Admin configuration: accounts with these emails are promoted to admin,
+	// and with AdminDemoteUnlisted other admins are demoted
+	AdminEmails         []string
+	AdminDemoteUnlisted bool
 	
-	// Feature flags
-	RunMigrations bool
-}
-
-func Load() (*Config, error) {
-	cfg := &Config{
-		Port:        getEnv("PORT", "10000"),
-		Environment: getEnv("ENVIRONMENT", "development"),
-		
-		DatabaseURL: getEnv("DATABASE_URL", ""),
-		
-		SecretKeyBase: getEnv("SECRET_KEY_BASE", ""),
-		CSRFSecret:    getEnv("CSRF_SECRET", ""),
-		
-		CookieDomain: getEnv("COOKIE_DOMAIN", ".lvh.me"),
-		
-		JWTIssuer: getEnv("JWT_ISSUER", "passport.oceanheart.ai"),
-		
-		RateLimitSignIn:       getEnvAsInt("RATE_LIMIT_SIGNIN", 10),
-		RateLimitSignInWindow: getEnvAsDuration("RATE_LIMIT_SIGNIN_WINDOW", 3*time.Minute),
-		
-		RunMigrations: getEnvAsBool("RUN_MIGRATIONS", false),
-	}
-
-	// Set cookie secure based on environment
-	cfg.CookieSecure = cfg.Environment == "production"
+	// GeoIP configuration (path to a MaxMind-format .mmdb file, optional)
+	GeoIPDatabasePath string
 	
-	// Override cookie domain for production
-	if cfg.Environment == "production" {
-		cfg.CookieDomain = ".oceanheart.ai"
-	}
+	// Mail configuration (emails are logged when SMTPHost is empty)
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
 	
-	// Use CSRF secret from SECRET_KEY_BASE if not set
-	if cfg.CSRFSecret == "" {
-		cfg.CSRFSecret = cfg.SecretKeyBase
-	}
+	// Notification configuration
+	NewDeviceAlerts bool
 	
-	// Validate required configuration
-	if cfg.SecretKeyBase == "" {
-		return nil, fmt.Errorf("SECRET_KEY_BASE is required")
-	}
+	// Logging configuration (LogFormat is "json" or "text")
+	LogLevel  string
+	LogFormat string
 	
-	if cfg.DatabaseURL == "" {
-		return nil, fmt.Errorf("DATABASE_URL is required")
-	}
+	// Metrics configuration: a separate listen address, or a bearer token
+	// protecting /metrics on the main port; with neither it isn't served
+	MetricsAddr  string
+	MetricsToken string
 	
-	return cfg, nil
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvAsInt(key string, defaultValue int) int {
-	strValue := os.Getenv(key)
-	if strValue == "" {
-		return defaultValue
-	}
-	
-	value, err := strconv.Atoi(strValue)
-	if err != nil {
-		return defaultValue
-	}
-	
-	return value
-}
-
-func getEnvAsBool(key string, defaultValue bool) bool {
-	strValue := os.Getenv(key)
-	if strValue == "" {
-		return defaultValue
-	}
-	
-	value, err := strconv.ParseBool(strValue)
-	if err != nil {
-		return defaultValue
-	}
-	
-	return value
-}
-
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	strValue := os.Getenv(key)
-	if strValue == "" {
-		return defaultValue
-	}
-	
-	value, err := time.ParseDuration(strValue)
-	if err != nil {
-		return defaultValue
-	}
-	
-	return value
+	// Probes: per-check readiness timeout, and how long /readyz reports
+	// shutting_down before the server stops accepting connections
+	HealthCheckTimeout time.Duration
+	ShutdownDrainDelay time.Duration
+	
+	// Tracing configuration (TracesExporter is "none", "otlp" or "stdout";
+	// the OTLP endpoint comes from the standard OTEL_EXPORTER_OTLP_* variables)
+	TracesExporter string
+	ServiceName    string
+	
+	// Feature flags
+	RunMigrations bool
+	
+	// ConfigFile is the YAML file the configuration was loaded from, if any
+	ConfigFile string
+	
+	// Polling interval for reloading ConfigFile when it changes (0 disables)
+	ConfigWatchInterval time.Duration
+	
+	// sources records where each setting's value came from, by key
+	sources map[string]string
 }
 
 func (c *Config) IsDevelopment() bool {
@@ -3,27 +3,112 @@ package config
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"strings"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"github.com/oceanheart/go-passport/internal/tracing"
+)
+
+// Dialect is the kind of database DATABASE_URL points at.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
 )
 
+// system returns the dialect's name in OpenTelemetry's db.system attribute.
+func (d Dialect) system() string {
+	if d == Postgres {
+		return "postgresql"
+	}
+	return string(d)
+}
+
+var ErrUnsupportedDatabase = errors.New("unsupported database URL (use postgres://... or sqlite:PATH)")
+
+// sqlitePragmas are set on every SQLite connection: foreign keys for
+// cascading deletes, and waiting for a lock rather than failing at once.
+// Timestamps are written as text that sorts chronologically.
+const sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+
+// ParseDatabaseURL returns the dialect a database URL selects and the data
+// source name for its driver. postgres:// and postgresql:// URLs are passed
+// to pgx unchanged; sqlite:PATH, sqlite://PATH and sqlite:///ABSOLUTE/PATH
+// open a file (sqlite::memory: a private in-memory database).
+func ParseDatabaseURL(url string) (Dialect, string, error) {
+	scheme, rest, _ := strings.Cut(url, ":")
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return Postgres, url, nil
+	case "sqlite", "sqlite3":
+		path, query, _ := strings.Cut(strings.TrimPrefix(rest, "//"), "?")
+		if path == "" {
+			return "", "", fmt.Errorf("%w: missing SQLite file path", ErrUnsupportedDatabase)
+		}
+		if query != "" {
+			query += "&"
+		}
+		return SQLite, "file:" + path + "?" + query + sqlitePragmas, nil
+	}
+	return "", "", ErrUnsupportedDatabase
+}
+
+// maxTransactionAttempts bounds how often WithTransaction runs a
+// transaction that keeps failing with a serialization failure or deadlock.
+const maxTransactionAttempts = 3
+
+// Database wraps the connection pool. Its query methods shadow those of
+// *sql.DB so that every statement gets a tracing span, errors go through
+// TranslateError, and statements join the transaction from Transact
+// carried by the context.
 type Database struct {
 	*sql.DB
+	Dialect Dialect
+}
+
+// Row is a *sql.Row whose Scan translates errors with TranslateError.
+type Row struct {
+	*sql.Row
+}
+
+func (r *Row) Scan(dest ...any) error {
+	return TranslateError(r.Row.Scan(dest...))
 }
 
 func NewDatabase(cfg *Config) (*Database, error) {
-	db, err := sql.Open("pgx", cfg.DatabaseURL)
+	dialect, dsn, err := ParseDatabaseURL(cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := "pgx"
+	if dialect == SQLite {
+		driver = "sqlite"
+	}
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Configure connection pool
+	// Configure connection pool. SQLite allows one writer at a time, and an
+	// in-memory database exists only on the connection that created it.
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(5 * time.Minute)
 	db.SetConnMaxIdleTime(10 * time.Minute)
+	if dialect == SQLite {
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+		db.SetConnMaxIdleTime(0)
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -33,20 +118,104 @@ func NewDatabase(cfg *Config) (*Database, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &Database{DB: db}, nil
+	return &Database{DB: db, Dialect: dialect}, nil
 }
 
 func (db *Database) Close() error {
 	return db.DB.Close()
 }
 
+func (db *Database) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := tracing.StartQuery(ctx, db.Dialect.system(), query)
+	defer span.End()
+
+	rows, err := db.conn(ctx).QueryContext(ctx, query, db.args(args)...)
+	tracing.RecordError(span, err)
+	return rows, TranslateError(err)
+}
+
+func (db *Database) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	ctx, span := tracing.StartQuery(ctx, db.Dialect.system(), query)
+	defer span.End()
+
+	row := db.conn(ctx).QueryRowContext(ctx, query, db.args(args)...)
+	tracing.RecordError(span, row.Err())
+	return &Row{Row: row}
+}
+
+func (db *Database) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := tracing.StartQuery(ctx, db.Dialect.system(), query)
+	defer span.End()
+
+	result, err := db.conn(ctx).ExecContext(ctx, query, db.args(args)...)
+	tracing.RecordError(span, err)
+	return result, TranslateError(err)
+}
+
+// args adapts query arguments to the dialect. SQLite compares timestamps as
+// text, which only orders them correctly in a single time zone, so they are
+// stored in UTC.
+func (db *Database) args(args []any) []any {
+	if db.Dialect != SQLite {
+		return args
+	}
+
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			arg = t.UTC()
+		}
+		converted[i] = arg
+	}
+	return converted
+}
+
+// WithTransaction runs fn in a transaction, committing if it returns nil.
+// Transactions that fail with a serialization failure or deadlock are
+// rolled back and run again, up to maxTransactionAttempts times, so fn must
+// be safe to repeat and keep its effects inside tx. If ctx carries a
+// transaction from Transact, fn runs in that one instead.
 func (db *Database) WithTransaction(ctx context.Context, fn func(*sql.Tx) error) error {
+	if state := db.txState(ctx); state != nil {
+		return TranslateError(fn(state.tx))
+	}
+
+	return db.runTransaction(ctx, func(_ context.Context, tx *sql.Tx) error {
+		return fn(tx)
+	})
+}
+
+func (db *Database) runTransaction(ctx context.Context, fn func(context.Context, *sql.Tx) error) (err error) {
+	ctx, span := tracing.Start(ctx, "transaction")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		err = db.transaction(ctx, fn)
+		if err == nil || !retryable(err) || attempt == maxTransactionAttempts {
+			return err
+		}
+
+		// Back off a little, with jitter, so the conflicting transactions
+		// don't collide again
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(rand.Int64N(int64(attempt) * int64(10*time.Millisecond)))):
+		}
+	}
+}
+
+func (db *Database) transaction(ctx context.Context, fn func(context.Context, *sql.Tx) error) error {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", TranslateError(err))
 	}
 
-	if err := fn(tx); err != nil {
+	if err := fn(ctx, tx); err != nil {
+		err = TranslateError(err)
 		if rbErr := tx.Rollback(); rbErr != nil {
 			return fmt.Errorf("failed to rollback transaction: %v (original error: %w)", rbErr, err)
 		}
@@ -54,7 +223,7 @@ func (db *Database) WithTransaction(ctx context.Context, fn func(*sql.Tx) error)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", TranslateError(err))
 	}
 
 	return nil
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Kinds of database errors, matched with errors.Is on errors returned by
+// Database. errors.As with *DBError gives the constraint.
+var (
+	ErrUniqueViolation      = errors.New("unique constraint violated")
+	ErrForeignKeyViolation  = errors.New("foreign key constraint violated")
+	ErrCheckViolation       = errors.New("check constraint violated")
+	ErrSerializationFailure = errors.New("serialization failure")
+	ErrDeadlock             = errors.New("deadlock detected")
+)
+
+// DBError is a driver error translated by TranslateError. It matches both
+// its Kind and the driver's error.
+type DBError struct {
+	Kind error
+	// Constraint is the violated constraint, e.g. users_email_address_key
+	// in Postgres or users.email_address in SQLite, when the driver
+	// reports it.
+	Constraint string
+	Err        error
+}
+
+func (e *DBError) Error() string {
+	if e.Constraint == "" {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Constraint)
+}
+
+func (e *DBError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// pgErrorKinds maps Postgres SQLSTATE codes, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+var pgErrorKinds = map[string]error{
+	"23505": ErrUniqueViolation,
+	"23503": ErrForeignKeyViolation,
+	"23514": ErrCheckViolation,
+	"40001": ErrSerializationFailure,
+	"40P01": ErrDeadlock,
+}
+
+// sqliteErrorKinds maps SQLite extended result codes.
+var sqliteErrorKinds = map[int]error{
+	sqlite3.SQLITE_CONSTRAINT_UNIQUE:     ErrUniqueViolation,
+	sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY: ErrUniqueViolation,
+	sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY: ErrForeignKeyViolation,
+	sqlite3.SQLITE_CONSTRAINT_CHECK:      ErrCheckViolation,
+	// A WAL snapshot went stale while the transaction ran
+	sqlite3.SQLITE_BUSY_SNAPSHOT: ErrSerializationFailure,
+}
+
+// TranslateError turns Postgres and SQLite constraint violations and
+// transaction conflicts into a *DBError. Other errors, including ones
+// already translated, are returned unchanged. Database does this for its
+// own methods; call it on errors from a *sql.Tx or *sql.Conn.
+func TranslateError(err error) error {
+	var translated *DBError
+	if err == nil || errors.As(err, &translated) {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		kind, ok := pgErrorKinds[pgErr.Code]
+		if !ok {
+			return err
+		}
+		return &DBError{Kind: kind, Constraint: pgErr.ConstraintName, Err: err}
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		kind, ok := sqliteErrorKinds[sqliteErr.Code()]
+		if !ok {
+			return err
+		}
+		return &DBError{Kind: kind, Constraint: sqliteConstraint(sqliteErr.Error()), Err: err}
+	}
+
+	return err
+}
+
+// sqliteConstraint extracts the columns from messages like "constraint
+// failed: UNIQUE constraint failed: users.email_address (2067)". SQLite
+// doesn't name foreign key constraints.
+func sqliteConstraint(msg string) string {
+	const marker = "constraint failed: "
+	i := strings.LastIndex(msg, marker)
+	if i < 0 {
+		return ""
+	}
+	detail, _, _ := strings.Cut(msg[i+len(marker):], " (")
+	return detail
+}
+
+// retryable reports whether a transaction failing with err can be run again
+// from the start.
+func retryable(err error) bool {
+	return errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrDeadlock)
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Setting is the effective value of one setting, with secrets redacted.
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// Settings lists the effective configuration in documentation order.
+// Secret values are redacted, so the result is safe to print or log.
+func (c *Config) Settings() []Setting {
+	values := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		value := s.format(c)
+		if s.redact != nil {
+			value = s.redact(value)
+		}
+		source := c.sources[s.key]
+		if source == "" {
+			source = SourceDefault
+		}
+		values = append(values, Setting{Key: s.key, Value: value, Source: source})
+	}
+	return values
+}
+
+// String renders the effective configuration with secrets redacted, so
+// printing or logging a Config never leaks them.
+func (c *Config) String() string {
+	var b strings.Builder
+	for i, s := range c.Settings() {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%q", s.Key, s.Value)
+	}
+	return b.String()
+}
+
+// GoString is the %#v form, redacted like String.
+func (c *Config) GoString() string {
+	return "config.Config{" + c.String() + "}"
+}
+
+// LogValue logs the configuration as a group of redacted settings.
+func (c *Config) LogValue() slog.Value {
+	settings := c.Settings()
+	attrs := make([]slog.Attr, 0, len(settings))
+	for _, s := range settings {
+		attrs = append(attrs, slog.String(s.Key, s.Value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Changes compares c with next, a freshly loaded configuration, and
+// returns the keys of changed settings that can be applied at runtime and
+// of those that need a restart.
+func (c *Config) Changes(next *Config) (reloadable, restart []string) {
+	for _, s := range settings {
+		if s.format(c) == s.format(next) {
+			continue
+		}
+		if s.reloadable {
+			reloadable = append(reloadable, s.key)
+		} else {
+			restart = append(restart, s.key)
+		}
+	}
+	return reloadable, restart
+}
+
+// WithReloadable returns a copy of c with the reloadable settings taken
+// from next. Settings that need a restart keep their current values.
+func (c *Config) WithReloadable(next *Config) *Config {
+	merged := *c
+	merged.sources = make(map[string]string, len(c.sources))
+	for key, source := range c.sources {
+		merged.sources[key] = source
+	}
+
+	for _, s := range settings {
+		if !s.reloadable {
+			continue
+		}
+		// next was validated when loaded, so this can't fail
+		if err := s.parse(&merged, s.format(next)); err != nil {
+			panic(fmt.Sprintf("config: reapplying %s: %v", s.key, err))
+		}
+		merged.sources[s.key] = next.sources[s.key]
+	}
+	return &merged
+}
+
+// WriteReference writes a Markdown table documenting every setting, its
+// default and its description.
+func WriteReference(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "| Variable | Default | Description |\n|----------|---------|-------------|"); err != nil {
+		return err
+	}
+	for _, s := range settings {
+		description := s.help
+		if s.required {
+			description += " (required)"
+		}
+		if s.secret() {
+			description += " (secret; or `" + s.key + "_FILE`)"
+		}
+		if s.reloadable {
+			description += " (reloadable)"
+		}
+		if len(s.oneOf) > 0 {
+			description += "; one of `" + strings.Join(s.oneOf, "`, `") + "`"
+		}
+		if s.bounds != nil {
+			description += "; " + s.bounds.describe(s.boundsFormat())
+		}
+		if _, err := fmt.Fprintf(w, "| `%s` | %s | %s |\n", s.key, s.def.doc, description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable that can point at a config
+// file instead of the --config flag.
+const ConfigFileEnv = "PASSPORT_CONFIG"
+
+// Sources a setting's value can come from, in increasing precedence.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Load resolves the configuration from, in increasing precedence, the
+// defaults, a YAML config file (--config or PASSPORT_CONFIG), environment
+// variables and command line flags in args. Every value is parsed strictly:
+// all invalid, unknown or missing settings are reported together.
+//
+// Secret settings are read from KEY_FILE files or KEY environment variables,
+// then from providers, and given as flags only by file (--secret-key-base-file)
+// so they don't show up in process listings.
+func Load(args []string, providers ...SecretProvider) (*Config, error) {
+	return load(args, os.LookupEnv, providers...)
+}
+
+type rawValue struct {
+	value    string
+	source   string
+	location string
+}
+
+func load(args []string, lookupEnv func(string) (string, bool), providers ...SecretProvider) (*Config, error) {
+	flagValues, configPath, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	if configPath == "" {
+		configPath, _ = lookupEnv(ConfigFileEnv)
+	}
+
+	var fileValues map[string]rawValue
+	if configPath != "" {
+		if fileValues, err = readConfigFile(configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	secretProviders := append([]SecretProvider{
+		&FileSecretProvider{lookupEnv: lookupEnv},
+		&EnvSecretProvider{lookupEnv: lookupEnv},
+	}, providers...)
+
+	cfg := &Config{ConfigFile: configPath, sources: make(map[string]string, len(settings))}
+	var errs []error
+
+	for _, s := range settings {
+		raw := rawValue{value: s.def.value(cfg), source: SourceDefault, location: s.key}
+		if v, ok := fileValues[s.key]; ok {
+			raw = v
+		}
+		if s.secret() {
+			v, ok, err := lookupSecret(secretProviders, s.key)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.key, err))
+				continue
+			}
+			if ok {
+				raw = v
+			}
+		} else if v, ok := lookupEnv(s.key); ok && v != "" {
+			raw = rawValue{value: v, source: SourceEnv, location: s.key}
+		}
+		if v, ok := flagValues[s.key]; ok {
+			raw = v
+		}
+
+		if err := s.parse(cfg, raw.value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", raw.location, err))
+			continue
+		}
+		if s.required && raw.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", s.key))
+		}
+		if s.check != nil {
+			if err := s.check(cfg); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", raw.location, err))
+			}
+		}
+		if s.strong && cfg.IsProduction() && raw.source != SourceDefault && raw.value != "" {
+			if err := checkSecretStrength(raw.value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", raw.location, err))
+			}
+		}
+		cfg.sources[s.key] = raw.source
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parse sets the setting's field from its textual value.
+func (s setting) parse(cfg *Config, value string) error {
+	switch field := s.field(cfg).(type) {
+	case *string:
+		if len(s.oneOf) > 0 && !contains(s.oneOf, value) {
+			return fmt.Errorf("must be one of %s, got %q", strings.Join(s.oneOf, ", "), value)
+		}
+		*field = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		if err := s.bounds.check(int64(n), formatInt); err != nil {
+			return err
+		}
+		*field = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (use true or false)", value)
+		}
+		*field = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (use e.g. 30s, 10m, 1h)", value)
+		}
+		if d < 0 {
+			return fmt.Errorf("duration must not be negative, got %q", value)
+		}
+		if err := s.bounds.check(int64(d), formatDuration); err != nil {
+			return err
+		}
+		*field = d
+	case *[]string:
+		*field = splitList(value)
+	default:
+		panic(fmt.Sprintf("config: unsupported type %T for %s", field, s.key))
+	}
+	return nil
+}
+
+// format renders the setting's current value the way it would be written
+// in the environment.
+func (s setting) format(cfg *Config) string {
+	switch field := s.field(cfg).(type) {
+	case *string:
+		return *field
+	case *int:
+		return strconv.Itoa(*field)
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *time.Duration:
+		return field.String()
+	case *[]string:
+		return strings.Join(*field, ",")
+	default:
+		panic(fmt.Sprintf("config: unsupported type %T for %s", field, s.key))
+	}
+}
+
+// boundsFormat returns how the setting's bounds are written.
+func (s setting) boundsFormat() func(int64) string {
+	if _, ok := s.field(&Config{}).(*time.Duration); ok {
+		return formatDuration
+	}
+	return formatInt
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func formatDuration(n int64) string {
+	return time.Duration(n).String()
+}
+
+func (s setting) fileKey() string {
+	return strings.ToLower(s.key)
+}
+
+func (s setting) flagName() string {
+	name := strings.ReplaceAll(strings.ToLower(s.key), "_", "-")
+	if s.secret() {
+		return name + "-file"
+	}
+	return name
+}
+
+// secret settings are redacted from output and read from providers.
+func (s setting) secret() bool {
+	return s.redact != nil
+}
+
+// parseFlags returns the values of the settings given as flags, keyed by
+// setting key, and the --config path.
+func parseFlags(args []string) (map[string]rawValue, string, error) {
+	values := make(map[string]rawValue)
+	fs, configPath := newFlagSet(values)
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return values, *configPath, nil
+}
+
+func newFlagSet(values map[string]rawValue) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("passport", flag.ContinueOnError)
+	configPath := fs.String("config", "", "YAML config file (or set "+ConfigFileEnv+")")
+
+	for _, s := range settings {
+		s := s
+		set := func(value string) error {
+			values[s.key] = rawValue{value: value, source: SourceFlag, location: "--" + s.flagName()}
+			return nil
+		}
+		help := strings.ReplaceAll(s.help, "`", "") + " (" + s.key + ")"
+		if s.secret() {
+			fs.Func(s.flagName(), "File containing the "+help, func(path string) error {
+				value, err := readSecretFile(path)
+				if err != nil {
+					return err
+				}
+				values[s.key] = rawValue{value: value, source: SourceSecretFile, location: "--" + s.flagName()}
+				return nil
+			})
+		} else if _, ok := s.field(&Config{}).(*bool); ok {
+			fs.BoolFunc(s.flagName(), help, set)
+		} else {
+			fs.Func(s.flagName(), help, set)
+		}
+	}
+	return fs, configPath
+}
+
+// PrintFlags writes the usage of the command line flags to w.
+func PrintFlags(w io.Writer) {
+	fs, _ := newFlagSet(make(map[string]rawValue))
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// readConfigFile reads a flat YAML mapping of lower-case setting keys to
+// scalars or lists.
+func readConfigFile(path string) (map[string]rawValue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: config file must be a mapping of settings", path, root.Line)
+	}
+
+	keys := make(map[string]string, len(settings))
+	for _, s := range settings {
+		keys[s.fileKey()] = s.key
+	}
+
+	values := make(map[string]rawValue)
+	var errs []error
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		keyNode, valueNode := root.Content[i], root.Content[i+1]
+		location := fmt.Sprintf("%s:%d: %s", path, keyNode.Line, keyNode.Value)
+
+		key, ok := keys[keyNode.Value]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s:%d: unknown setting %q", path, keyNode.Line, keyNode.Value))
+			continue
+		}
+		if _, dup := values[key]; dup {
+			errs = append(errs, fmt.Errorf("%s: set more than once", location))
+			continue
+		}
+
+		value, err := nodeValue(valueNode)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", location, err))
+			continue
+		}
+		values[key] = rawValue{value: value, source: SourceFile, location: location}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func nodeValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return "", nil
+		}
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("list items must be scalars")
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("must be a scalar or a list")
+	}
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAll(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// redactURLPassword hides only the passwords of a connection URL, in its
+// userinfo or its password and sslpassword parameters, keeping the host and
+// database visible for debugging.
+func redactURLPassword(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" {
+		return redactAll(value)
+	}
+	query := u.Query()
+	redacted := false
+	for _, key := range []string{"password", "sslpassword"} {
+		if query.Has(key) {
+			query.Set(key, "xxxxx")
+			redacted = true
+		}
+	}
+	if redacted {
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
@@ -1,107 +1,522 @@
 package config
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
+	"log/slog"
+	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
+var (
+	ErrChecksumMismatch      = errors.New("applied migration was modified")
+	ErrIrreversibleMigration = errors.New("migration has no down file")
+	ErrUnknownVersion        = errors.New("unknown migration version")
+)
+
+// NoTransactionDirective, on a line of its own in a migration file, runs the
+// file outside a transaction, which statements like CREATE INDEX
+// CONCURRENTLY require. Such files should hold a single statement: a failure
+// halfway can't be rolled back.
+const NoTransactionDirective = "-- passport:no-transaction"
+
+// migrationLockName identifies the advisory lock held while migrating, so
+// instances booting together don't apply the same migration twice.
+const migrationLockName = "passport_migrations"
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one schema change, read from NNN_name.up.sql and the
+// optional NNN_name.down.sql.
+type Migration struct {
+	Version int64
+	// Name is the file name without the direction and extension, e.g.
+	// "001_create_users"; it's what schema_migrations records
+	Name string
+	Up   string
+	Down string
+	// Checksum is the SHA-256 of the up file, compared with the one stored
+	// when it was applied to detect edits
+	Checksum string
+}
+
+// MigrationStatus describes a migration and whether it has been applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified reports an applied migration whose file has changed since
+	Modified bool
+}
+
+// Migrator applies the migrations in a file system (usually the embedded
+// db/migrations) and records them in schema_migrations.
 type Migrator struct {
-	db *Database
+	db     *Database
+	source fs.FS
+	logger *slog.Logger
 }
 
-func NewMigrator(db *Database) *Migrator {
-	return &Migrator{db: db}
+func NewMigrator(db *Database, source fs.FS, logger *slog.Logger) *Migrator {
+	return &Migrator{db: db, source: source, logger: logger}
 }
 
-func (m *Migrator) Run(ctx context.Context, migrationsDir string) error {
-	// Create migrations table if not exists
-	if err := m.createMigrationsTable(ctx); err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	migrations, err := loadMigrations(m.source)
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+	return m.To(ctx, migrations[len(migrations)-1].Version)
+}
+
+// Down reverts the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(ctx context.Context, migrations []Migration, applied map[string]appliedMigration) error {
+		var names []string
+		for name := range applied {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return migrationVersion(names[i]) > migrationVersion(names[j]) })
+		if steps < len(names) {
+			names = names[:steps]
+		}
+
+		byName := make(map[string]Migration, len(migrations))
+		for _, migration := range migrations {
+			byName[migration.Name] = migration
+		}
+		for _, name := range names {
+			migration, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("failed to revert migration %s: %w", name, fs.ErrNotExist)
+			}
+			if err := m.revert(ctx, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// To applies or reverts migrations until exactly those up to version are
+// applied. Version 0 reverts everything.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	return m.locked(ctx, func(ctx context.Context, migrations []Migration, applied map[string]appliedMigration) error {
+		up, down, err := planMigrations(migrations, applied, version)
+		if err != nil {
+			return err
+		}
+		for _, migration := range down {
+			if err := m.revert(ctx, migration); err != nil {
+				return err
+			}
+		}
+		for _, migration := range up {
+			if err := m.apply(ctx, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status lists every migration, whether it has been applied, and whether
+// its file changed since.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(m.source)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if a, ok := applied[migration.Name]; ok {
+			status.Applied = true
+			status.AppliedAt = a.at
+			status.Modified = a.checksum != "" && a.checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
 	}
+	return statuses, nil
+}
 
-	// Get list of migration files
-	files, err := ioutil.ReadDir(migrationsDir)
+// Pending returns the names of the migrations that haven't been applied.
+func (m *Migrator) Pending(ctx context.Context) ([]string, error) {
+	statuses, err := m.Status(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return nil, err
 	}
 
-	// Sort migration files by name
-	var migrationFiles []string
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".sql") {
-			migrationFiles = append(migrationFiles, file.Name())
+	var pending []string
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, status.Name)
 		}
 	}
-	sort.Strings(migrationFiles)
+	return pending, nil
+}
 
-	// Run each migration
-	for _, file := range migrationFiles {
-		if err := m.runMigration(ctx, filepath.Join(migrationsDir, file)); err != nil {
-			return fmt.Errorf("failed to run migration %s: %w", file, err)
+// planMigrations returns the migrations to apply, in order, and to revert,
+// in reverse order, to reach version.
+func planMigrations(migrations []Migration, applied map[string]appliedMigration, version int64) (up, down []Migration, err error) {
+	known := version == 0
+	for _, migration := range migrations {
+		if migration.Version == version {
+			known = true
 		}
 	}
+	if !known {
+		return nil, nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
 
-	return nil
+	files := make(map[string]bool, len(migrations))
+	for _, migration := range migrations {
+		files[migration.Name] = true
+		_, isApplied := applied[migration.Name]
+		switch {
+		case migration.Version <= version && !isApplied:
+			up = append(up, migration)
+		case migration.Version > version && isApplied:
+			down = append([]Migration{migration}, down...)
+		}
+	}
+
+	// Applied migrations without files can only be kept
+	for name := range applied {
+		if !files[name] && migrationVersion(name) > version {
+			return nil, nil, fmt.Errorf("failed to revert migration %s: %w", name, fs.ErrNotExist)
+		}
+	}
+	return up, down, nil
+}
+
+// locked runs fn holding the migration lock, with the current migrations
+// and applied versions, after checking no applied migration was edited.
+func (m *Migrator) locked(ctx context.Context, fn func(context.Context, []Migration, map[string]appliedMigration) error) error {
+	migrations, err := loadMigrations(m.source)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.createMigrationsTable(ctx); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.verifyChecksums(ctx, migrations, applied); err != nil {
+		return err
+	}
+
+	return fn(ctx, migrations, applied)
+}
+
+// lock takes the Postgres advisory lock and returns the function releasing
+// it. SQLite has no such lock; each migration's transaction waits for the
+// database's single writer lock instead, and an instance that loses a race
+// fails to record the migration and can simply be restarted.
+func (m *Migrator) lock(ctx context.Context) (unlock func(), err error) {
+	if m.db.Dialect == SQLite {
+		return func() {}, nil
+	}
+
+	// Advisory locks belong to a session, so hold one connection throughout
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", migrationLockName).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if !acquired {
+		m.logger.InfoContext(ctx, "waiting for another instance to finish migrating")
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", migrationLockName); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", migrationLockName); err != nil {
+			m.logger.ErrorContext(ctx, "failed to release migration lock", "error", err)
+		}
+		conn.Close()
+	}, nil
 }
 
 func (m *Migrator) createMigrationsTable(ctx context.Context) error {
+	if m.db.Dialect == SQLite {
+		_, err := m.db.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version TEXT PRIMARY KEY,
+				applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				checksum TEXT
+			)`)
+		return err
+	}
+
 	query := `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version VARCHAR(255) PRIMARY KEY,
 			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
-		)`
-	
+		);
+		ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum TEXT;
+		UPDATE schema_migrations SET version = left(version, -4) WHERE version LIKE '%.sql'`
+
 	_, err := m.db.ExecContext(ctx, query)
 	return err
 }
 
-func (m *Migrator) runMigration(ctx context.Context, filePath string) error {
-	// Extract version from filename
-	version := filepath.Base(filePath)
-	
-	// Check if migration has already been applied
-	var count int
-	err := m.db.QueryRowContext(ctx, 
-		"SELECT COUNT(*) FROM schema_migrations WHERE version = $1", 
-		version,
-	).Scan(&count)
-	
+type appliedMigration struct {
+	at       time.Time
+	checksum string
+}
+
+// applied returns the applied migrations by name. Before the engine kept
+// up/down pairs, versions were recorded as file names ending in .sql and
+// the table had no checksum column; reading through to_jsonb copes with
+// both without altering the table, which the readiness check relies on.
+// SQLite databases never had the old layout.
+func (m *Migrator) applied(ctx context.Context) (map[string]appliedMigration, error) {
+	query := "SELECT version, applied_at, to_jsonb(m)->>'checksum' FROM schema_migrations m"
+	if m.db.Dialect == SQLite {
+		query = "SELECT version, applied_at, checksum FROM schema_migrations"
+	}
+
+	rows, err := m.db.QueryContext(ctx, query)
 	if err != nil {
-		return fmt.Errorf("failed to check migration status: %w", err)
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
 	}
-	
-	if count > 0 {
-		// Migration already applied
-		return nil
+	defer rows.Close()
+
+	applied := make(map[string]appliedMigration)
+	for rows.Next() {
+		var version string
+		var migration appliedMigration
+		var checksum sql.NullString
+		if err := rows.Scan(&version, &migration.at, &checksum); err != nil {
+			return nil, fmt.Errorf("failed to scan migration version: %w", err)
+		}
+		migration.checksum = checksum.String
+		applied[strings.TrimSuffix(version, ".sql")] = migration
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// verifyChecksums fails if an applied migration's file has changed.
+// Migrations applied before checksums were stored adopt the current one.
+func (m *Migrator) verifyChecksums(ctx context.Context, migrations []Migration, applied map[string]appliedMigration) error {
+	var errs []error
+	for _, migration := range migrations {
+		a, ok := applied[migration.Name]
+		if !ok {
+			continue
+		}
+		if a.checksum == "" {
+			if _, err := m.db.ExecContext(ctx,
+				"UPDATE schema_migrations SET checksum = $1 WHERE version = $2",
+				migration.Checksum, migration.Name,
+			); err != nil {
+				return fmt.Errorf("failed to record migration checksum: %w", err)
+			}
+			continue
+		}
+		if a.checksum != migration.Checksum {
+			errs = append(errs, fmt.Errorf("%w: %s (revert the edit and add a new migration instead)", ErrChecksumMismatch, migration.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	err := m.execMigration(ctx, migration.Up, func(exec execer) error {
+		_, err := exec.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, checksum) VALUES ($1, $2)",
+			migration.Name, migration.Checksum,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to run migration %s: %w", migration.Name, err)
+	}
+
+	m.logger.InfoContext(ctx, "applied migration", "migration", migration.Name)
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("failed to revert migration %s: %w", migration.Name, ErrIrreversibleMigration)
 	}
-	
-	// Read migration file
-	content, err := ioutil.ReadFile(filePath)
+
+	err := m.execMigration(ctx, migration.Down, func(exec execer) error {
+		_, err := exec.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Name)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to read migration file: %w", err)
+		return fmt.Errorf("failed to revert migration %s: %w", migration.Name, err)
 	}
-	
-	// Execute migration in a transaction
-	return m.db.WithTransaction(ctx, func(tx *sql.Tx) error {
-		// Execute migration SQL
-		if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+
+	m.logger.InfoContext(ctx, "reverted migration", "migration", migration.Name)
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// execMigration runs script and then record, in one transaction unless the
+// script opts out with NoTransactionDirective.
+func (m *Migrator) execMigration(ctx context.Context, script string, record func(execer) error) error {
+	run := func(exec execer) error {
+		if _, err := exec.ExecContext(ctx, script); err != nil {
 			return fmt.Errorf("failed to execute migration: %w", err)
 		}
-		
-		// Record migration as applied
-		if _, err := tx.ExecContext(ctx,
-			"INSERT INTO schema_migrations (version) VALUES ($1)",
-			version,
-		); err != nil {
+		if err := record(exec); err != nil {
 			return fmt.Errorf("failed to record migration: %w", err)
 		}
-		
-		fmt.Printf("Applied migration: %s\n", version)
 		return nil
+	}
+
+	if hasNoTransactionDirective(script) {
+		return run(m.db)
+	}
+	return m.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		return run(tx)
 	})
-}
\ No newline at end of file
+}
+
+// loadMigrations reads the migrations in source sorted by version, and
+// checks every down file has an up file and versions are unique.
+func loadMigrations(source fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	byName := make(map[string]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q (want NNN_name.up.sql or NNN_name.down.sql)", entry.Name())
+		}
+
+		content, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file: %w", err)
+		}
+
+		name := match[1] + "_" + match[2]
+		migration, ok := byName[name]
+		if !ok {
+			migration = &Migration{Version: migrationVersion(name), Name: name}
+			byName[name] = migration
+		}
+		if match[3] == "up" {
+			sum := sha256.Sum256(content)
+			migration.Up = string(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byName))
+	for _, migration := range byName {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %s has a down file but no up file", migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// migrationVersion returns the numeric prefix of a migration name, or 0.
+func migrationVersion(name string) int64 {
+	prefix, _, _ := strings.Cut(name, "_")
+	version, _ := strconv.ParseInt(prefix, 10, 64)
+	return version
+}
+
+func hasNoTransactionDirective(script string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == NoTransactionDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateMigration writes empty up and down files for a new migration named
+// name in dir, numbered after the highest existing version.
+func CreateMigration(dir, name string) (upPath, downPath string, err error) {
+	if !regexp.MustCompile(`^[a-z0-9_]+$`).MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q (use lower-case letters, digits and underscores)", name)
+	}
+
+	existing, err := loadMigrations(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var version int64 = 1
+	if len(existing) > 0 {
+		version = existing[len(existing)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%03d_%s", version, name))
+	upPath, downPath = base+".up.sql", base+".down.sql"
+	for _, path := range []string{upPath, downPath} {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create migration file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return "", "", fmt.Errorf("failed to create migration file: %w", err)
+		}
+	}
+	return upPath, downPath, nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/oceanheart/go-passport/db/migrations"
+)
+
+func TestLoadMigrationsEmbedded(t *testing.T) {
+	loaded, err := loadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) == 0 || loaded[0].Name != "001_create_users" {
+		t.Fatalf("loadMigrations() = %+v", loaded)
+	}
+	for i, migration := range loaded {
+		if migration.Version != int64(i+1) {
+			t.Errorf("%s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+		if migration.Down == "" {
+			t.Errorf("%s has no down migration", migration.Name)
+		}
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"invalid migration file name": {"001_users.sql": {Data: []byte("SELECT 1")}},
+		"has a down file but no up":   {"001_users.down.sql": {Data: []byte("SELECT 1")}},
+		"have the same version": {
+			"001_users.up.sql":  {Data: []byte("SELECT 1")},
+			"1_sessions.up.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+	for want, source := range tests {
+		if _, err := loadMigrations(source); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadMigrations() error = %v, want %q", err, want)
+		}
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	loaded, err := loadMigrations(fstest.MapFS{
+		"001_users.up.sql":      {Data: []byte("CREATE TABLE users ()")},
+		"001_users.down.sql":    {Data: []byte("DROP TABLE users")},
+		"002_sessions.up.sql":   {Data: []byte("CREATE TABLE sessions ()")},
+		"002_sessions.down.sql": {Data: []byte("DROP TABLE sessions")},
+		"003_index.up.sql":      {Data: []byte(NoTransactionDirective + "\nCREATE INDEX CONCURRENTLY i ON users (id)")},
+		"README.md":             {Data: []byte("ignored")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[0].Checksum == loaded[1].Checksum || len(loaded[0].Checksum) != 64 {
+		t.Errorf("unexpected checksums %q, %q", loaded[0].Checksum, loaded[1].Checksum)
+	}
+	if !hasNoTransactionDirective(loaded[2].Up) || hasNoTransactionDirective(loaded[0].Up) {
+		t.Error("no-transaction directive not detected")
+	}
+
+	names := func(migrations []Migration) string {
+		var names []string
+		for _, migration := range migrations {
+			names = append(names, migration.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	applied := map[string]appliedMigration{"001_users": {}, "002_sessions": {}}
+
+	up, down, err := planMigrations(loaded, applied, 3)
+	if err != nil || names(up) != "003_index" || len(down) != 0 {
+		t.Errorf("plan to 3 = up %q, down %q, %v", names(up), names(down), err)
+	}
+	up, down, err = planMigrations(loaded, applied, 0)
+	if err != nil || len(up) != 0 || names(down) != "002_sessions,001_users" {
+		t.Errorf("plan to 0 = up %q, down %q, %v", names(up), names(down), err)
+	}
+	if _, _, err := planMigrations(loaded, applied, 7); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("plan to 7 error = %v, want ErrUnknownVersion", err)
+	}
+
+	applied["004_gone"] = appliedMigration{}
+	if _, _, err := planMigrations(loaded, applied, 3); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("plan reverting a missing file error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"001_create_users.up.sql", "001_create_users.down.sql", "002_add_role.up.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upPath, downPath, err := CreateMigration(dir, "add_widgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(upPath) != "003_add_widgets.up.sql" || filepath.Base(downPath) != "003_add_widgets.down.sql" {
+		t.Fatalf("CreateMigration() = %q, %q", upPath, downPath)
+	}
+	if _, err := os.Stat(downPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := CreateMigration(dir, "Add Widgets"); err == nil {
+		t.Fatal("expected an error for an invalid name")
+	}
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// SourceSecretFile is the source of secrets read from a KEY_FILE file.
+const SourceSecretFile = "secret_file"
+
+// minSecretEntropy is the estimated entropy, in bits, that signing secrets
+// must have in production (64 hex characters from `openssl rand -hex 32`
+// have about 250).
+const minSecretEntropy = 128
+
+// SecretProvider supplies the values of secret settings such as
+// DATABASE_URL and SECRET_KEY_BASE, so they needn't be plain environment
+// variables. Lookup reports ok=false when the provider has no value for key;
+// Name is shown as the value's source.
+type SecretProvider interface {
+	Name() string
+	Lookup(key string) (value string, ok bool, err error)
+}
+
+// EnvSecretProvider reads secrets from environment variables named after
+// the setting.
+type EnvSecretProvider struct {
+	lookupEnv func(string) (string, bool)
+}
+
+func NewEnvSecretProvider() *EnvSecretProvider {
+	return &EnvSecretProvider{lookupEnv: os.LookupEnv}
+}
+
+func (p *EnvSecretProvider) Name() string { return SourceEnv }
+
+func (p *EnvSecretProvider) Lookup(key string) (string, bool, error) {
+	value, ok := p.lookupEnv(key)
+	return value, ok && value != "", nil
+}
+
+// FileSecretProvider reads secrets from the file named by the setting's
+// KEY_FILE environment variable, the Docker and Kubernetes secrets
+// convention. A trailing newline is ignored.
+type FileSecretProvider struct {
+	lookupEnv func(string) (string, bool)
+}
+
+func NewFileSecretProvider() *FileSecretProvider {
+	return &FileSecretProvider{lookupEnv: os.LookupEnv}
+}
+
+func (p *FileSecretProvider) Name() string { return SourceSecretFile }
+
+func (p *FileSecretProvider) Lookup(key string) (string, bool, error) {
+	path, ok := p.lookupEnv(key + "_FILE")
+	if !ok || path == "" {
+		return "", false, nil
+	}
+	if value, ok := p.lookupEnv(key); ok && value != "" {
+		return "", false, fmt.Errorf("set only one of %s and %s_FILE", key, key)
+	}
+
+	value, err := readSecretFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return value, nil
+}
+
+// lookupSecret returns the value of the first provider that has one.
+func lookupSecret(providers []SecretProvider, key string) (rawValue, bool, error) {
+	for _, p := range providers {
+		value, ok, err := p.Lookup(key)
+		if err != nil {
+			return rawValue{}, false, fmt.Errorf("%s: %w", p.Name(), err)
+		}
+		if ok {
+			return rawValue{value: value, source: p.Name(), location: key}, true, nil
+		}
+	}
+	return rawValue{}, false, nil
+}
+
+var errWeakSecret = errors.New("secret is too weak")
+
+// checkSecretStrength rejects secrets whose estimated entropy is below
+// minSecretEntropy.
+func checkSecretStrength(value string) error {
+	if bits := secretEntropy(value); bits < minSecretEntropy {
+		return fmt.Errorf("%w: about %.0f bits of entropy, need %d (generate one with `openssl rand -hex 64`)", errWeakSecret, bits, minSecretEntropy)
+	}
+	return nil
+}
+
+// secretEntropy estimates the entropy of value in bits as its length times
+// the Shannon entropy of its characters. It overestimates dictionary words
+// but catches short, repetitive and placeholder secrets.
+func secretEntropy(value string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, c := range value {
+		counts[c]++
+		n++
+	}
+
+	var perChar float64
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		perChar -= p * math.Log2(p)
+	}
+	return perChar * float64(n)
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// setting describes one configuration value. key is its environment
+// variable; the config file key is its lower-case form and the flag its
+// lower-case form with dashes (RATE_LIMIT_SIGNIN, rate_limit_signin,
+// --rate-limit-signin).
+type setting struct {
+	key      string
+	help     string
+	def      defaultValue
+	redact   func(value string) string
+	required bool
+	oneOf    []string
+	// bounds limits the value of an int or duration setting
+	bounds *bounds
+	// check validates the parsed value against the settings before it
+	check func(c *Config) error
+	// reloadable settings are applied by a configuration reload; the
+	// others need a restart
+	reloadable bool
+	// strong secrets must have minSecretEntropy bits in production
+	strong bool
+
+	field func(c *Config) interface{}
+}
+
+// defaultValue is a setting's default as text, which may depend on the
+// settings resolved before it (ENVIRONMENT comes first).
+type defaultValue struct {
+	value func(c *Config) string
+	doc   string
+}
+
+func fixed(value string) defaultValue {
+	doc := "`" + value + "`"
+	if value == "" {
+		doc = "-"
+	}
+	return defaultValue{value: func(*Config) string { return value }, doc: doc}
+}
+
+func byEnvironment(production, other string) defaultValue {
+	return defaultValue{
+		value: func(c *Config) string {
+			if c.Environment == "production" {
+				return production
+			}
+			return other
+		},
+		doc: fmt.Sprintf("%s in production, %s otherwise", fixed(production).doc, fixed(other).doc),
+	}
+}
+
+func derived(doc string, value func(c *Config) string) defaultValue {
+	return defaultValue{value: value, doc: doc}
+}
+
+// bounds is the range of an int or duration setting, durations counted in
+// nanoseconds. A nil max leaves the range open above.
+type bounds struct {
+	min int64
+	max *int64
+}
+
+func atLeast(min int64) *bounds {
+	return &bounds{min: min}
+}
+
+func between(min, max int64) *bounds {
+	return &bounds{min: min, max: &max}
+}
+
+// check reports n if it's out of range, formatting numbers with format.
+func (b *bounds) check(n int64, format func(int64) string) error {
+	if b == nil || n >= b.min && (b.max == nil || n <= *b.max) {
+		return nil
+	}
+	return fmt.Errorf("must be %s, got %s", b.describe(format), format(n))
+}
+
+func (b *bounds) describe(format func(int64) string) string {
+	if b.max == nil {
+		return "at least " + format(b.min)
+	}
+	return fmt.Sprintf("between %s and %s", format(b.min), format(*b.max))
+}
+
+// settings lists every field of Config, in resolution order.
+var settings = []setting{
+	// Server
+	{key: "ENVIRONMENT", def: fixed("development"), help: "`development`, `production` or `test`; selects environment-specific defaults",
+		field: func(c *Config) interface{} { return &c.Environment }},
+	{key: "PORT", def: fixed("10000"), help: "HTTP listen port",
+		field: func(c *Config) interface{} { return &c.Port }},
+	{key: "APP_URL", help: "Public URL used in emailed links",
+		def: derived("`https://passport.oceanheart.ai` in production, `http://passport.lvh.me:$PORT` otherwise", func(c *Config) string {
+			if c.Environment == "production" {
+				return "https://passport.oceanheart.ai"
+			}
+			return "http://passport.lvh.me:" + c.Port
+		}),
+		field: func(c *Config) interface{} { return &c.AppURL }},
+
+	// Database
+	{key: "DATABASE_URL", def: fixed(""), required: true, redact: redactURLPassword, help: "`postgres://...` connection string, or `sqlite:PATH` for an embedded SQLite file",
+		check: func(c *Config) error {
+			if c.DatabaseURL == "" {
+				return nil
+			}
+			_, _, err := ParseDatabaseURL(c.DatabaseURL)
+			return err
+		},
+		field: func(c *Config) interface{} { return &c.DatabaseURL }},
+	{key: "RUN_MIGRATIONS", def: fixed("false"), help: "Apply pending migrations on startup",
+		field: func(c *Config) interface{} { return &c.RunMigrations }},
+
+	// Security
+	{key: "SECRET_KEY_BASE", def: fixed(""), required: true, redact: redactAll, strong: true, help: "JWT and token signing key (shared with the Rails app)",
+		field: func(c *Config) interface{} { return &c.SecretKeyBase }},
+	{key: "CSRF_SECRET", redact: redactAll, strong: true, help: "CSRF token signing key",
+		def:   derived("`SECRET_KEY_BASE`", func(c *Config) string { return c.SecretKeyBase }),
+		field: func(c *Config) interface{} { return &c.CSRFSecret }},
+	{key: "COOKIE_DOMAIN", def: byEnvironment(".oceanheart.ai", ".lvh.me"), help: "Domain of the session cookies",
+		field: func(c *Config) interface{} { return &c.CookieDomain }},
+	{key: "COOKIE_SECURE", def: byEnvironment("true", "false"), help: "Send cookies over HTTPS only",
+		field: func(c *Config) interface{} { return &c.CookieSecure }},
+	{key: "TRUSTED_PROXIES", def: fixed(""), help: "Proxies (CIDRs or addresses) whose CLIENT_IP_HEADER is trusted",
+		field: func(c *Config) interface{} { return &c.TrustedProxies }},
+	{key: "CLIENT_IP_HEADER", def: fixed("X-Forwarded-For"), oneOf: []string{"X-Forwarded-For", "Forwarded", "X-Real-IP"}, help: "The forwarding header TRUSTED_PROXIES set; others are ignored",
+		field: func(c *Config) interface{} { return &c.ClientIPHeader }},
+
+	// Security headers
+	{key: "HSTS_MAX_AGE", reloadable: true, def: byEnvironment("8760h", "0s"), help: "HSTS max-age; 0 disables HSTS",
+		field: func(c *Config) interface{} { return &c.HSTSMaxAge }},
+	{key: "HSTS_INCLUDE_SUBDOMAINS", reloadable: true, def: fixed("true"), help: "Add includeSubDomains to HSTS",
+		field: func(c *Config) interface{} { return &c.HSTSIncludeSubdomains }},
+	{key: "CSP_REPORT_ONLY", reloadable: true, def: fixed("false"), help: "Send the CSP as Content-Security-Policy-Report-Only",
+		field: func(c *Config) interface{} { return &c.CSPReportOnly }},
+	{key: "CSP_REPORT_URI", reloadable: true, def: fixed("/csp-report"), help: "Where browsers report CSP violations",
+		field: func(c *Config) interface{} { return &c.CSPReportURI }},
+	{key: "FRAME_ANCESTORS", reloadable: true, def: fixed("'none'"), help: "CSP frame-ancestors sources",
+		field: func(c *Config) interface{} { return &c.FrameAncestors }},
+	{key: "REFERRER_POLICY", reloadable: true, def: fixed("strict-origin-when-cross-origin"), help: "Referrer-Policy header",
+		field: func(c *Config) interface{} { return &c.ReferrerPolicy }},
+	{key: "PERMISSIONS_POLICY", reloadable: true, def: fixed("camera=(), microphone=(), geolocation=(), payment=()"), help: "Permissions-Policy header",
+		field: func(c *Config) interface{} { return &c.PermissionsPolicy }},
+
+	// CORS and redirects
+	{key: "CORS_ALLOWED_ORIGINS", reloadable: true, help: "Origins allowed to call /api/auth with credentials (exact or `https://*.domain`)",
+		def: byEnvironment(
+			"https://oceanheart.ai,https://*.oceanheart.ai",
+			"http://localhost:3000,http://localhost:3001,http://localhost:5173,http://lvh.me:3000,http://*.lvh.me:3000",
+		),
+		field: func(c *Config) interface{} { return &c.CORSAllowedOrigins }},
+	{key: "CORS_MAX_AGE", reloadable: true, def: fixed("10m"), help: "How long browsers may cache preflight results",
+		field: func(c *Config) interface{} { return &c.CORSMaxAge }},
+	{key: "RETURN_TO_ALLOWED_HOSTS", reloadable: true, def: byEnvironment("oceanheart.ai,*.oceanheart.ai", "lvh.me,*.lvh.me,localhost"), help: "Hosts return_to may redirect to",
+		field: func(c *Config) interface{} { return &c.ReturnToAllowedHosts }},
+
+	// JWT and caching
+	{key: "JWT_ISSUER", def: fixed("passport.oceanheart.ai"), help: "JWT iss claim",
+		field: func(c *Config) interface{} { return &c.JWTIssuer }},
+	{key: "AUTH_CACHE_SIZE", bounds: atLeast(1), def: fixed("10000"), help: "Max cached users and sessions (each)",
+		field: func(c *Config) interface{} { return &c.AuthCacheSize }},
+	{key: "AUTH_CACHE_TTL", def: fixed("30s"), help: "Auth cache entry lifetime; 0 disables the cache",
+		field: func(c *Config) interface{} { return &c.AuthCacheTTL }},
+
+	// Rate limiting
+	{key: "RATE_LIMIT_STORE", def: fixed("memory"), oneOf: []string{"memory", "postgres"}, help: "`memory` (per instance) or `postgres` (shared)",
+		check: func(c *Config) error {
+			if dialect, _, _ := ParseDatabaseURL(c.DatabaseURL); c.RateLimitStore == "postgres" && dialect != Postgres {
+				return errors.New("postgres needs a postgres:// DATABASE_URL")
+			}
+			return nil
+		},
+		field: func(c *Config) interface{} { return &c.RateLimitStore }},
+	{key: "RATE_LIMIT_SIGNIN", reloadable: true, bounds: atLeast(1), def: fixed("10"), help: "Default per-IP sign-in limit",
+		field: func(c *Config) interface{} { return &c.RateLimitSignIn }},
+	{key: "RATE_LIMIT_SIGNIN_WINDOW", reloadable: true, bounds: atLeast(int64(time.Second)), def: fixed("3m"), help: "Window of RATE_LIMIT_SIGNIN",
+		field: func(c *Config) interface{} { return &c.RateLimitSignInWindow }},
+	{key: "RATE_LIMIT_POLICIES", reloadable: true, help: "Per-route policies, `route=dimensions:limit/window,...;...`",
+		def: derived("`sign_in=ip:$RATE_LIMIT_SIGNIN/$RATE_LIMIT_SIGNIN_WINDOW,email:20/15m;sign_up=ip:5/1h;refresh=user:30/1m;password_reset=ip:10/1h;csp_report=ip:60/1m`", func(c *Config) string {
+			return fmt.Sprintf(
+				"sign_in=ip:%d/%s,email:20/15m;sign_up=ip:5/1h;refresh=user:30/1m;password_reset=ip:10/1h;csp_report=ip:60/1m",
+				c.RateLimitSignIn, c.RateLimitSignInWindow,
+			)
+		}),
+		field: func(c *Config) interface{} { return &c.RateLimitPolicies }},
+
+	// Admin
+	{key: "ADMIN_EMAILS", reloadable: true, def: fixed(""), help: "Emails of users granted the admin role on startup and sign-up",
+		field: func(c *Config) interface{} { return &c.AdminEmails }},
+	{key: "ADMIN_DEMOTE_UNLISTED", reloadable: true, def: fixed("false"), help: "Demote admins whose email isn't in ADMIN_EMAILS",
+		field: func(c *Config) interface{} { return &c.AdminDemoteUnlisted }},
+
+	// Sessions and mail
+	{key: "GEOIP_DATABASE_PATH", def: fixed(""), help: "MaxMind-format .mmdb file for session locations",
+		field: func(c *Config) interface{} { return &c.GeoIPDatabasePath }},
+	{key: "SMTP_HOST", def: fixed(""), help: "SMTP server; required in production, emails are logged when empty",
+		check: func(c *Config) error {
+			// Password reset emails always go out, and their links must
+			// not end up in the logs
+			if c.IsProduction() && c.SMTPHost == "" {
+				return errors.New("is required in production, where password reset and new device emails can't be logged")
+			}
+			return nil
+		},
+		field: func(c *Config) interface{} { return &c.SMTPHost }},
+	{key: "SMTP_PORT", bounds: between(1, 65535), def: fixed("587"), help: "SMTP port",
+		field: func(c *Config) interface{} { return &c.SMTPPort }},
+	{key: "SMTP_USERNAME", def: fixed(""), help: "SMTP username",
+		field: func(c *Config) interface{} { return &c.SMTPUsername }},
+	{key: "SMTP_PASSWORD", def: fixed(""), redact: redactAll, help: "SMTP password",
+		field: func(c *Config) interface{} { return &c.SMTPPassword }},
+	{key: "MAIL_FROM", def: fixed("Passport <no-reply@oceanheart.ai>"), help: "From address of outgoing mail",
+		field: func(c *Config) interface{} { return &c.MailFrom }},
+	{key: "NEW_DEVICE_ALERTS", def: byEnvironment("true", "false"), help: "Email users about sign-ins from new devices",
+		field: func(c *Config) interface{} { return &c.NewDeviceAlerts }},
+
+	// Observability
+	{key: "LOG_LEVEL", reloadable: true, def: fixed("info"), oneOf: []string{"debug", "info", "warn", "error"}, help: "Minimum log level",
+		field: func(c *Config) interface{} { return &c.LogLevel }},
+	{key: "LOG_FORMAT", def: fixed("json"), oneOf: []string{"json", "text"}, help: "Log output format",
+		field: func(c *Config) interface{} { return &c.LogFormat }},
+	{key: "METRICS_ADDR", def: fixed(""), help: "Listen address of a separate metrics server",
+		field: func(c *Config) interface{} { return &c.MetricsAddr }},
+	{key: "METRICS_TOKEN", def: fixed(""), redact: redactAll, strong: true, help: "Bearer token for /metrics on the main port",
+		field: func(c *Config) interface{} { return &c.MetricsToken }},
+	{key: "OTEL_TRACES_EXPORTER", def: fixed("none"), oneOf: []string{"none", "otlp", "stdout"}, help: "Trace exporter",
+		field: func(c *Config) interface{} { return &c.TracesExporter }},
+	{key: "OTEL_SERVICE_NAME", def: fixed("go-passport"), help: "service.name of exported spans",
+		field: func(c *Config) interface{} { return &c.ServiceName }},
+	{key: "CONFIG_WATCH_INTERVAL", def: fixed("0s"), help: "How often to check the config file for changes and reload it; 0 reloads on SIGHUP only",
+		field: func(c *Config) interface{} { return &c.ConfigWatchInterval }},
+	{key: "HEALTH_CHECK_TIMEOUT", bounds: atLeast(int64(time.Millisecond)), def: fixed("2s"), help: "Timeout of each readiness check",
+		field: func(c *Config) interface{} { return &c.HealthCheckTimeout }},
+	{key: "SHUTDOWN_DRAIN_DELAY", def: byEnvironment("5s", "0s"), help: "Time /readyz fails before the server stops accepting connections",
+		field: func(c *Config) interface{} { return &c.ShutdownDrainDelay }},
+}
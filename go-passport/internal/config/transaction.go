@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+)
+
+type txKey struct{}
+
+// txState is the transaction carried by a context passed to Transact's fn.
+type txState struct {
+	db          *Database
+	tx          *sql.Tx
+	afterCommit []func()
+	// done is set once the transaction has committed or rolled back, so
+	// work that outlives it, e.g. in a goroutine, uses the pool again
+	done bool
+}
+
+// Transact runs fn in a transaction that travels in the context fn is given.
+// Database's query methods, and so every repository, run on it when called
+// with that context or one derived from it, which lets services compose
+// several repository calls atomically. Calls to Transact or WithTransaction
+// inside fn join the outer transaction. As with WithTransaction, fn may run
+// more than once.
+func (db *Database) Transact(ctx context.Context, fn func(ctx context.Context) error) error {
+	if db.txState(ctx) != nil {
+		return fn(ctx)
+	}
+
+	var state *txState
+	err := db.runTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		state = &txState{db: db, tx: tx}
+		defer func() { state.done = true }()
+		return fn(context.WithValue(ctx, txKey{}, state))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range state.afterCommit {
+		hook()
+	}
+
+	return nil
+}
+
+// InTransaction reports whether ctx carries a transaction from Transact that
+// is still open.
+func InTransaction(ctx context.Context) bool {
+	state, _ := ctx.Value(txKey{}).(*txState)
+	return state != nil && !state.done
+}
+
+// AfterCommit runs fn once the transaction carried by ctx has committed, or
+// right away if there is none. fn doesn't run if the transaction rolls back.
+func AfterCommit(ctx context.Context, fn func()) {
+	state, _ := ctx.Value(txKey{}).(*txState)
+	if state == nil || state.done {
+		fn()
+		return
+	}
+	state.afterCommit = append(state.afterCommit, fn)
+}
+
+// txState returns the open transaction of db carried by ctx, if any.
+func (db *Database) txState(ctx context.Context) *txState {
+	state, _ := ctx.Value(txKey{}).(*txState)
+	if state == nil || state.done || state.db != db {
+		return nil
+	}
+	return state
+}
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// conn returns the transaction carried by ctx, or the pool.
+func (db *Database) conn(ctx context.Context) querier {
+	if state := db.txState(ctx); state != nil {
+		return state.tx
+	}
+	return db.DB
+}
@@ -0,0 +1,85 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is the approximate location of an IP address. Fields are empty
+// when the address is unknown or no database has been configured.
+type Location struct {
+	CountryCode string
+	Country     string
+	City        string
+}
+
+// Reader looks up IP addresses in a MaxMind-format (GeoLite2/GeoIP2 City or
+// Country) database. A nil *Reader is valid and resolves every address to an
+// empty Location, so callers don't need to care whether GeoIP is configured.
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+type record struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+}
+
+// Open loads the database at path. An empty path returns a nil Reader.
+func Open(path string) (*Reader, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+
+	return &Reader{db: db}, nil
+}
+
+func (r *Reader) Lookup(address string) Location {
+	if r == nil {
+		return Location{}
+	}
+
+	ip := parseIP(address)
+	if ip == nil {
+		return Location{}
+	}
+
+	var rec record
+	if err := r.db.Lookup(ip, &rec); err != nil {
+		return Location{}
+	}
+
+	return Location{
+		CountryCode: rec.Country.IsoCode,
+		Country:     rec.Country.Names["en"],
+		City:        rec.City.Names["en"],
+	}
+}
+
+func (r *Reader) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.db.Close()
+}
+
+func parseIP(address string) net.IP {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	return net.ParseIP(address)
+}
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"encoding/json"
-	"html/template"
 	"net/http"
 	"strconv"
 
@@ -17,14 +16,14 @@ type AdminHandler struct {
 	userService    *service.UserService
 	sessionService *service.SessionService
 	config         *config.Config
-	templates      *template.Template
+	templates      *Templates
 }
 
 func NewAdminHandler(
 	userService *service.UserService,
 	sessionService *service.SessionService,
 	config *config.Config,
-	templates *template.Template,
+	templates *Templates,
 ) *AdminHandler {
 	return &AdminHandler{
 		userService:    userService,
@@ -47,12 +46,13 @@ func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"Title":      "Admin Dashboard - Passport",
 		"CSRFToken":  middleware.GetCSRFToken(r),
+		"CSPNonce":   middleware.GetCSPNonce(r),
 		"User":       user,
 		"TotalUsers": totalUsers,
 		"RecentUsers": users,
 	}
 
-	if err := h.templates.ExecuteTemplate(w, "admin/dashboard.html", data); err != nil {
+	if err := renderTemplate(r.Context(), h.templates, w, "admin/dashboard.html", data); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -94,6 +94,7 @@ func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"Title":       "Users - Admin",
 		"CSRFToken":   middleware.GetCSRFToken(r),
+		"CSPNonce":    middleware.GetCSPNonce(r),
 		"User":        middleware.GetUser(r.Context()),
 		"Users":       users,
 		"CurrentPage": page,
@@ -106,7 +107,7 @@ func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		"PrevPage":    page - 1,
 	}
 
-	if err := h.templates.ExecuteTemplate(w, "admin/users.html", data); err != nil {
+	if err := renderTemplate(r.Context(), h.templates, w, "admin/users.html", data); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -136,12 +137,13 @@ func (h *AdminHandler) ShowUser(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"Title":      "User Details - Admin",
 		"CSRFToken":  middleware.GetCSRFToken(r),
+		"CSPNonce":   middleware.GetCSPNonce(r),
 		"User":       middleware.GetUser(r.Context()),
 		"ViewUser":   user,
 		"Sessions":   sessions,
 	}
 
-	if err := h.templates.ExecuteTemplate(w, "admin/user_detail.html", data); err != nil {
+	if err := renderTemplate(r.Context(), h.templates, w, "admin/user_detail.html", data); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -54,7 +54,7 @@ func (h *APIHandler) SignIn(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get client IP and user agent
-	clientIP := getClientIP(r)
+	clientIP := middleware.GetClientIP(r)
 	userAgent := r.UserAgent()
 
 	// Authenticate user
@@ -2,11 +2,11 @@ package handlers
 
 import (
 	"fmt"
-	"html/template"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/oceanheart/go-passport/internal/auth"
 	"github.com/oceanheart/go-passport/internal/config"
 	"github.com/oceanheart/go-passport/internal/middleware"
 	"github.com/oceanheart/go-passport/internal/models"
@@ -14,23 +14,29 @@ import (
 )
 
 type AuthHandler struct {
-	authService *service.AuthService
-	userService *service.UserService
-	config      *config.Config
-	templates   *template.Template
+	authService    *service.AuthService
+	userService    *service.UserService
+	sessionService *service.SessionService
+	redirects      *auth.RedirectSanitizer
+	config         *config.Config
+	templates      *Templates
 }
 
 func NewAuthHandler(
 	authService *service.AuthService,
 	userService *service.UserService,
+	sessionService *service.SessionService,
+	redirects *auth.RedirectSanitizer,
 	config *config.Config,
-	templates *template.Template,
+	templates *Templates,
 ) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		userService: userService,
-		config:      config,
-		templates:   templates,
+		authService:    authService,
+		userService:    userService,
+		sessionService: sessionService,
+		redirects:      redirects,
+		config:         config,
+		templates:      templates,
 	}
 }
 
@@ -38,10 +44,12 @@ func (h *AuthHandler) SignInPage(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"Title":     "Sign In - Passport",
 		"CSRFToken": middleware.GetCSRFToken(r),
+		"CSPNonce":  middleware.GetCSPNonce(r),
 		"User":      middleware.GetUser(r.Context()),
+		"ReturnTo":  h.returnTo(r),
 	}
 
-	if err := h.templates.ExecuteTemplate(w, "signin.html", data); err != nil {
+	if err := renderTemplate(r.Context(), h.templates, w, "sessions/signin.html", data); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -57,20 +65,22 @@ func (h *AuthHandler) SignIn(w http.ResponseWriter, r *http.Request) {
 	password := r.FormValue("password")
 
 	// Get client IP and user agent
-	clientIP := getClientIP(r)
+	clientIP := middleware.GetClientIP(r)
 	userAgent := r.UserAgent()
 
 	// Authenticate user
-	user, session, token, err := h.authService.SignIn(r.Context(), email, password, clientIP, userAgent)
+	_, session, token, err := h.authService.SignIn(r.Context(), email, password, clientIP, userAgent)
 	if err != nil {
 		data := map[string]interface{}{
 			"Title":     "Sign In - Passport",
 			"CSRFToken": middleware.GetCSRFToken(r),
+			"CSPNonce":  middleware.GetCSPNonce(r),
 			"Error":     "Invalid email or password",
+			"ReturnTo":  h.returnTo(r),
 		}
 		
 		w.WriteHeader(http.StatusUnauthorized)
-		h.templates.ExecuteTemplate(w, "signin.html", data)
+		renderTemplate(r.Context(), h.templates, w, "sessions/signin.html", data)
 		return
 	}
 
@@ -80,23 +90,19 @@ func (h *AuthHandler) SignIn(w http.ResponseWriter, r *http.Request) {
 	// Set JWT cookie
 	h.setJWTCookie(w, token)
 
-	// Check for return_to parameter
-	returnTo := r.FormValue("return_to")
-	if returnTo == "" {
-		returnTo = "/"
-	}
-
-	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+	h.redirectBack(w, r)
 }
 
 func (h *AuthHandler) SignUpPage(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"Title":     "Sign Up - Passport",
 		"CSRFToken": middleware.GetCSRFToken(r),
+		"CSPNonce":  middleware.GetCSPNonce(r),
 		"User":      middleware.GetUser(r.Context()),
+		"ReturnTo":  h.returnTo(r),
 	}
 
-	if err := h.templates.ExecuteTemplate(w, "signup.html", data); err != nil {
+	if err := renderTemplate(r.Context(), h.templates, w, "registrations/signup.html", data); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -117,11 +123,13 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 		data := map[string]interface{}{
 			"Title":     "Sign Up - Passport",
 			"CSRFToken": middleware.GetCSRFToken(r),
+			"CSPNonce":  middleware.GetCSPNonce(r),
 			"Error":     "Passwords do not match",
+			"ReturnTo":  h.returnTo(r),
 		}
 		
 		w.WriteHeader(http.StatusBadRequest)
-		h.templates.ExecuteTemplate(w, "signup.html", data)
+		renderTemplate(r.Context(), h.templates, w, "registrations/signup.html", data)
 		return
 	}
 
@@ -131,16 +139,18 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 		Password:     password,
 	}
 
-	user, session, token, err := h.authService.SignUp(r.Context(), params)
+	_, session, token, err := h.authService.SignUp(r.Context(), params, middleware.GetClientIP(r), r.UserAgent())
 	if err != nil {
 		data := map[string]interface{}{
 			"Title":     "Sign Up - Passport",
 			"CSRFToken": middleware.GetCSRFToken(r),
+			"CSPNonce":  middleware.GetCSPNonce(r),
 			"Error":     err.Error(),
+			"ReturnTo":  h.returnTo(r),
 		}
 		
 		w.WriteHeader(http.StatusBadRequest)
-		h.templates.ExecuteTemplate(w, "signup.html", data)
+		renderTemplate(r.Context(), h.templates, w, "registrations/signup.html", data)
 		return
 	}
 
@@ -150,40 +160,63 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 	// Set JWT cookie
 	h.setJWTCookie(w, token)
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	h.redirectBack(w, r)
 }
 
 func (h *AuthHandler) SignOut(w http.ResponseWriter, r *http.Request) {
 	// Get session from cookie
 	if cookie, err := r.Cookie("session_id"); err == nil {
-		sessionID := cookie.Value
-		// Attempt to delete session (ignore errors)
-		h.authService.SignOut(r.Context(), sessionID)
+		if sessionID, err := strconv.ParseInt(cookie.Value, 10, 64); err == nil {
+			// Attempt to delete session (ignore errors)
+			h.authService.SignOut(r.Context(), sessionID)
+		}
 	}
 
 	// Clear cookies
 	h.clearSessionCookie(w)
 	h.clearJWTCookie(w)
 
-	// Check for return_to parameter
-	returnTo := r.FormValue("return_to")
-	if returnTo == "" {
-		returnTo = "/"
+	h.redirectBack(w, r)
+}
+
+// returnTo is the request's return_to value if it is safe to redirect to.
+func (h *AuthHandler) returnTo(r *http.Request) string {
+	return h.redirects.Sanitize(r.FormValue("return_to"))
+}
+
+// redirectBack sends the user to return_to, or home if it is missing or
+// not allowed.
+func (h *AuthHandler) redirectBack(w http.ResponseWriter, r *http.Request) {
+	target := h.returnTo(r)
+	if target == "" {
+		target = "/"
 	}
 
-	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+	http.Redirect(w, r, target, http.StatusSeeOther)
 }
 
 func (h *AuthHandler) CurrentUser(w http.ResponseWriter, r *http.Request) {
 	user := middleware.GetUser(r.Context())
 	
+	var sessions []*models.Session
+	if user != nil {
+		var err error
+		sessions, err = h.sessionService.GetUserSessions(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	
 	data := map[string]interface{}{
 		"Title":     "Dashboard - Passport",
 		"CSRFToken": middleware.GetCSRFToken(r),
+		"CSPNonce":  middleware.GetCSPNonce(r),
 		"User":      user,
+		"Sessions":  sessions,
 	}
 
-	if err := h.templates.ExecuteTemplate(w, "dashboard.html", data); err != nil {
+	if err := renderTemplate(r.Context(), h.templates, w, "shared/dashboard.html", data); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -255,13 +288,3 @@ func (h *AuthHandler) clearJWTCookie(w http.ResponseWriter) {
 		Expires:  time.Now().Add(-time.Hour),
 	})
 }
-
-func getClientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
-	}
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-	return r.RemoteAddr
-}
\ No newline at end of file
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// CSPReportHandler collects Content-Security-Policy violation reports sent
+// by browsers and writes them to the log.
+type CSPReportHandler struct {
+	logger *slog.Logger
+}
+
+func NewCSPReportHandler(logger *slog.Logger) *CSPReportHandler {
+	return &CSPReportHandler{logger: logger}
+}
+
+// cspViolation holds the fields we log from both report formats: the
+// legacy report-uri body ({"csp-report": {...}}, kebab-case) and the
+// Reporting API ([{"type": "csp-violation", "body": {...}}], camelCase).
+type cspViolation struct {
+	DocumentURI        string `json:"document-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	BlockedURI         string `json:"blocked-uri"`
+	DocumentURL        string `json:"documentURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	BlockedURL         string `json:"blockedURL"`
+	Disposition        string `json:"disposition"`
+}
+
+func (h *CSPReportHandler) Report(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	var violations []cspViolation
+
+	var legacy struct {
+		Report *cspViolation `json:"csp-report"`
+	}
+	var reports []struct {
+		Type string       `json:"type"`
+		Body cspViolation `json:"body"`
+	}
+
+	switch {
+	case json.Unmarshal(body, &legacy) == nil && legacy.Report != nil:
+		violations = append(violations, *legacy.Report)
+	case json.Unmarshal(body, &reports) == nil:
+		for _, report := range reports {
+			if report.Type == "csp-violation" {
+				violations = append(violations, report.Body)
+			}
+		}
+	default:
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	for _, v := range violations {
+		if v.DocumentURI == "" {
+			v.DocumentURI, v.ViolatedDirective, v.BlockedURI = v.DocumentURL, v.EffectiveDirective, v.BlockedURL
+		}
+		h.logger.WarnContext(r.Context(), "CSP violation",
+			"disposition", v.Disposition,
+			"directive", v.ViolatedDirective,
+			"blocked_uri", v.BlockedURI,
+			"document_uri", v.DocumentURI,
+		)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/oceanheart/go-passport/internal/tracing"
+)
+
+// layout wraps every page; it renders the page's "content" block.
+const layout = "layouts/main.html"
+
+// Templates holds one template set per page. Every page defines the same
+// "content" block, so each is parsed separately together with the layout.
+type Templates struct {
+	pages map[string]*template.Template
+}
+
+// LoadTemplates parses the pages under dir, keyed by their path relative to
+// dir, e.g. "admin/user_detail.html".
+func LoadTemplates(dir string) (*Templates, error) {
+	if _, err := os.Stat(filepath.Join(dir, layout)); err != nil {
+		return nil, fmt.Errorf("failed to load layout: %w", err)
+	}
+
+	t := &Templates{pages: make(map[string]*template.Template)}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".html" {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if name == layout {
+			return nil
+		}
+
+		page, err := template.ParseFiles(filepath.Join(dir, layout), path)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		t.pages[name] = page
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+
+	if len(t.pages) == 0 {
+		return nil, fmt.Errorf("no templates found in %s", dir)
+	}
+
+	return t, nil
+}
+
+// ExecuteTemplate renders the page called name inside the layout.
+func (t *Templates) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	page, ok := t.pages[name]
+	if !ok {
+		return fmt.Errorf("template %q not found", name)
+	}
+	return page.Execute(w, data)
+}
+
+// renderTemplate executes a page template inside a span, so slow renders
+// show up separately from the service calls in a request's trace.
+func renderTemplate(ctx context.Context, templates *Templates, w io.Writer, name string, data interface{}) error {
+	_, span := tracing.Start(ctx, "render "+name)
+	defer span.End()
+	span.SetAttributes(attribute.String("template", name))
+
+	err := templates.ExecuteTemplate(w, name, data)
+	tracing.RecordError(span, err)
+	return err
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/mail/mailtest"
+	"github.com/oceanheart/go-passport/internal/models"
+	"github.com/oceanheart/go-passport/internal/repository"
+	"github.com/oceanheart/go-passport/internal/service"
+)
+
+type testEnv struct {
+	store    *repository.MemoryStore
+	mailer   *mailtest.Recorder
+	resets   *service.PasswordResetService
+	alerts   *service.DeviceAlertService
+	security *SecurityHandler
+	admin    *AdminHandler
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	templates, err := LoadTemplates("../../web/templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := repository.NewMemoryStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mailer := &mailtest.Recorder{}
+	passwords := auth.NewPasswordService()
+	signer := auth.NewTokenSigner("test-secret")
+	cfg := &config.Config{}
+
+	resets := service.NewPasswordResetService(store.Users(), store.Sessions(), store, passwords, mailer, signer, "https://passport.test", logger)
+	alerts := service.NewDeviceAlertService(store.Users(), store.Sessions(), store, passwords, resets, mailer, signer, "https://passport.test", true, logger)
+	users := service.NewUserService(store.Users(), logger)
+	sessions := service.NewSessionService(store.Sessions(), store.Users(), service.NewSessionEnricher(nil), logger)
+
+	return &testEnv{
+		store:    store,
+		mailer:   mailer,
+		resets:   resets,
+		alerts:   alerts,
+		security: NewSecurityHandler(alerts, resets, cfg, templates, logger),
+		admin:    NewAdminHandler(users, sessions, cfg, templates),
+	}
+}
+
+func (e *testEnv) createUser(t *testing.T) (*models.User, *models.Session) {
+	t.Helper()
+	ctx := context.Background()
+	user := &models.User{EmailAddress: "alice@example.com", PasswordDigest: "digest"}
+	if err := e.store.Users().Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	session := &models.Session{UserID: user.ID, IPAddress: "198.51.100.7", Browser: "Firefox 120", OS: "Linux", DeviceType: "desktop"}
+	if err := e.store.Sessions().Create(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	return user, session
+}
+
+// checkPage checks that a page was rendered inside the layout and contains
+// each of want.
+func checkPage(t *testing.T, rec *httptest.ResponseRecorder, status int, want ...string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body %q", rec.Code, status, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, s := range append([]string{"<!DOCTYPE html>", "terminal-content"}, want...) {
+		if !strings.Contains(body, s) {
+			t.Errorf("body doesn't contain %q:\n%s", s, body)
+		}
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	templates, err := LoadTemplates("../../web/templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"sessions/signin.html", "registrations/signup.html", "shared/dashboard.html", "sessions/not_me.html", "passwords/reset.html", "admin/dashboard.html", "admin/user_detail.html"} {
+		if _, ok := templates.pages[name]; !ok {
+			t.Errorf("template %q not loaded", name)
+		}
+	}
+	if _, ok := templates.pages[layout]; ok {
+		t.Error("layout loaded as a page")
+	}
+}
+
+func TestAdminShowUser(t *testing.T) {
+	e := newTestEnv(t)
+	user, _ := e.createUser(t)
+
+	router := chi.NewRouter()
+	router.Get("/admin/users/{id}", e.admin.ShowUser)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/users/1", nil))
+
+	checkPage(t, rec, http.StatusOK, "admin user 1", user.EmailAddress, "sessions (1)", "Firefox 120")
+}
+
+func TestNotMePage(t *testing.T) {
+	e := newTestEnv(t)
+	user, session := e.createUser(t)
+	if err := e.alerts.NotifyNewDevice(context.Background(), user, session); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	e.security.NotMePage(rec, httptest.NewRequest(http.MethodGet, "/sessions/not_me?token="+url.QueryEscape(mailtest.LinkToken(t, e.mailer.Last(t).Body)), nil))
+	checkPage(t, rec, http.StatusOK, "passport secure-account", "This Wasn't Me")
+
+	rec = httptest.NewRecorder()
+	e.security.NotMePage(rec, httptest.NewRequest(http.MethodGet, "/sessions/not_me?token=bogus", nil))
+	checkPage(t, rec, http.StatusBadRequest, "passport secure-account", service.ErrInvalidAlertToken.Error())
+}
+
+func TestPasswordResetPage(t *testing.T) {
+	e := newTestEnv(t)
+	user, _ := e.createUser(t)
+	if err := e.resets.SendResetEmail(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	e.security.PasswordResetPage(rec, httptest.NewRequest(http.MethodGet, "/password/reset?token="+url.QueryEscape(mailtest.LinkToken(t, e.mailer.Last(t).Body)), nil))
+	checkPage(t, rec, http.StatusOK, "passport reset-password", "Choose a new password")
+
+	rec = httptest.NewRecorder()
+	e.security.PasswordResetPage(rec, httptest.NewRequest(http.MethodGet, "/password/reset?token=bogus", nil))
+	checkPage(t, rec, http.StatusBadRequest, "passport reset-password", service.ErrInvalidResetToken.Error())
+}
+
+func TestResetPassword(t *testing.T) {
+	e := newTestEnv(t)
+	user, _ := e.createUser(t)
+	if err := e.resets.SendResetEmail(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	token := mailtest.LinkToken(t, e.mailer.Last(t).Body)
+
+	post := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {token}, "password": {password}, "password_confirmation": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		e.security.ResetPassword(rec, req)
+		return rec
+	}
+
+	checkPage(t, post("short"), http.StatusBadRequest, auth.ErrPasswordTooShort.Error())
+	checkPage(t, post("a much longer password"), http.StatusOK, "Password updated")
+	// The link stops working once the password has changed
+	checkPage(t, post("another long password"), http.StatusBadRequest, service.ErrInvalidResetToken.Error())
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/middleware"
+	"github.com/oceanheart/go-passport/internal/service"
+)
+
+// SecurityHandler serves the pages reached from security emails: the
+// "this wasn't me" confirmation and the password reset form.
+type SecurityHandler struct {
+	deviceAlertService   *service.DeviceAlertService
+	passwordResetService *service.PasswordResetService
+	config               *config.Config
+	templates            *Templates
+	logger               *slog.Logger
+}
+
+func NewSecurityHandler(
+	deviceAlertService *service.DeviceAlertService,
+	passwordResetService *service.PasswordResetService,
+	config *config.Config,
+	templates *Templates,
+	logger *slog.Logger,
+) *SecurityHandler {
+	return &SecurityHandler{
+		deviceAlertService:   deviceAlertService,
+		passwordResetService: passwordResetService,
+		config:               config,
+		templates:            templates,
+		logger:               logger,
+	}
+}
+
+// NotMePage asks the user to confirm before anything is revoked, so link
+// scanners that prefetch emailed URLs can't trigger it.
+func (h *SecurityHandler) NotMePage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	data := map[string]interface{}{
+		"Title":     "Secure Your Account - Passport",
+		"CSRFToken": middleware.GetCSRFToken(r),
+		"CSPNonce":  middleware.GetCSPNonce(r),
+		"Token":     token,
+	}
+
+	if _, _, err := h.deviceAlertService.ValidateToken(r.Context(), token); err != nil {
+		data["Error"] = service.ErrInvalidAlertToken.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	if err := renderTemplate(r.Context(), h.templates, w, "sessions/not_me.html", data); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *SecurityHandler) NotMe(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     "Secure Your Account - Passport",
+		"CSRFToken": middleware.GetCSRFToken(r),
+		"CSPNonce":  middleware.GetCSPNonce(r),
+	}
+
+	if err := h.deviceAlertService.ReportUnrecognizedSession(r.Context(), r.FormValue("token")); err != nil {
+		if errors.Is(err, service.ErrInvalidAlertToken) {
+			data["Error"] = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			h.logger.ErrorContext(r.Context(), "failed to handle unrecognized session report", "error", err)
+			data["Error"] = "Something went wrong, please try again"
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		renderTemplate(r.Context(), h.templates, w, "sessions/not_me.html", data)
+		return
+	}
+
+	data["Secured"] = true
+	if err := renderTemplate(r.Context(), h.templates, w, "sessions/not_me.html", data); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *SecurityHandler) PasswordResetPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	data := map[string]interface{}{
+		"Title":     "Reset Password - Passport",
+		"CSRFToken": middleware.GetCSRFToken(r),
+		"CSPNonce":  middleware.GetCSPNonce(r),
+		"Token":     token,
+	}
+
+	if _, err := h.passwordResetService.ValidateToken(r.Context(), token); err != nil {
+		data["Error"] = service.ErrInvalidResetToken.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	if err := renderTemplate(r.Context(), h.templates, w, "passwords/reset.html", data); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *SecurityHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	passwordConfirm := r.FormValue("password_confirmation")
+
+	data := map[string]interface{}{
+		"Title":     "Reset Password - Passport",
+		"CSRFToken": middleware.GetCSRFToken(r),
+		"CSPNonce":  middleware.GetCSPNonce(r),
+		"Token":     token,
+	}
+
+	if password != passwordConfirm {
+		data["Error"] = "Passwords do not match"
+		w.WriteHeader(http.StatusBadRequest)
+		renderTemplate(r.Context(), h.templates, w, "passwords/reset.html", data)
+		return
+	}
+
+	if _, err := h.passwordResetService.ResetPassword(r.Context(), token, password); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidResetToken):
+			data["Error"] = service.ErrInvalidResetToken.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, auth.ErrPasswordTooShort):
+			data["Error"] = auth.ErrPasswordTooShort.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			h.logger.ErrorContext(r.Context(), "failed to reset password", "error", err)
+			data["Error"] = "Something went wrong, please try again"
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		renderTemplate(r.Context(), h.templates, w, "passwords/reset.html", data)
+		return
+	}
+
+	data["Reset"] = true
+	if err := renderTemplate(r.Context(), h.templates, w, "passwords/reset.html", data); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
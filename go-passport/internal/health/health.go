@@ -0,0 +1,118 @@
+// Package health serves the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check is a named readiness dependency. Run should return promptly once
+// ctx is done.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type Checker struct {
+	checks       []Check
+	timeout      time.Duration
+	logger       *slog.Logger
+	shuttingDown atomic.Bool
+}
+
+type checkResult struct {
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type report struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// NewChecker returns a checker running checks concurrently, each bounded by
+// timeout.
+func NewChecker(timeout time.Duration, logger *slog.Logger, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// SetShuttingDown makes readiness fail from now on, so load balancers stop
+// routing new traffic while in-flight requests drain.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Livez reports that the process is up and serving. It deliberately checks
+// no dependencies: restarting the server won't fix a database outage.
+func (c *Checker) Livez(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, report{Status: "ok"})
+}
+
+// Readyz runs every check and reports 503 if any fails. Failure details are
+// logged rather than returned, since driver errors can reveal hosts and
+// credentials.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	if c.shuttingDown.Load() {
+		writeReport(w, http.StatusServiceUnavailable, report{Status: "shutting_down"})
+		return
+	}
+
+	results := c.run(r.Context())
+
+	status, code := "ok", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	writeReport(w, code, report{Status: status, Checks: results})
+}
+
+func (c *Checker) run(ctx context.Context) map[string]checkResult {
+	results := make(map[string]checkResult, len(c.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Run(checkCtx)
+			result := checkResult{Status: "ok", DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "fail"
+				c.logger.WarnContext(ctx, "readiness check failed", "check", check.Name, "error", err)
+			}
+
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+
+	wg.Wait()
+	return results
+}
+
+func writeReport(w http.ResponseWriter, code int, r report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(r)
+}
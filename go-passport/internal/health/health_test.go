@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	ok := Check{Name: "database", Run: func(ctx context.Context) error { return nil }}
+	failing := Check{Name: "migrations", Run: func(ctx context.Context) error {
+		return errors.New("password=hunter2 host=db.internal")
+	}}
+	slow := Check{Name: "slow", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		shutdown   bool
+		wantCode   int
+		wantStatus string
+	}{
+		{"all passing", []Check{ok}, false, http.StatusOK, "ok"},
+		{"one failing", []Check{ok, failing}, false, http.StatusServiceUnavailable, "unavailable"},
+		{"timeout", []Check{ok, slow}, false, http.StatusServiceUnavailable, "unavailable"},
+		{"shutting down", []Check{ok}, true, http.StatusServiceUnavailable, "shutting_down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(10*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)), tt.checks...)
+			if tt.shutdown {
+				checker.SetShuttingDown()
+			}
+
+			rec := httptest.NewRecorder()
+			checker.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			body := rec.Body.String()
+			var got report
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("invalid JSON %q: %v", body, err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got.Status, tt.wantStatus)
+			}
+			if !tt.shutdown && len(got.Checks) != len(tt.checks) {
+				t.Errorf("got %d check results, want %d", len(got.Checks), len(tt.checks))
+			}
+			if strings.Contains(body, "hunter2") {
+				t.Errorf("response leaks check error: %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package logging builds the structured logger shared by the server: JSON
+// (or text) slog output with request correlation fields and redaction of
+// sensitive values.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a logger writing to w at the given level. format is "json"
+// or "text". Pass a *slog.LevelVar to change the level at runtime.
+func New(w io.Writer, level slog.Leveler, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error".
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
+
+// sensitiveKeys are matched as substrings of lower-cased attribute keys.
+var sensitiveKeys = []string{"password", "token", "secret", "cookie", "authorization", "api_key"}
+
+const redacted = "[REDACTED]"
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	return a
+}
+
+// Request correlation fields. They live behind a pointer in the context so
+// middleware further down the chain (e.g. authentication) can fill in the
+// user and session for log lines written by middleware further up.
+type fields struct {
+	mu        sync.Mutex
+	requestID string
+	userID    int64
+	sessionID int64
+}
+
+type contextKey struct{}
+
+// NewContext returns a context that carries correlation fields for one
+// request.
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &fields{requestID: requestID})
+}
+
+// SetUser records the authenticated user for the request in ctx.
+func SetUser(ctx context.Context, userID int64) {
+	if f, ok := ctx.Value(contextKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.userID = userID
+		f.mu.Unlock()
+	}
+}
+
+// SetSession records the session the request is authenticated with.
+func SetSession(ctx context.Context, sessionID int64) {
+	if f, ok := ctx.Value(contextKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.sessionID = sessionID
+		f.mu.Unlock()
+	}
+}
+
+// contextHandler adds the correlation fields, and the active trace and
+// span IDs, from the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if f, ok := ctx.Value(contextKey{}).(*fields); ok {
+		f.mu.Lock()
+		if f.requestID != "" {
+			r.AddAttrs(slog.String("request_id", f.requestID))
+		}
+		if f.userID != 0 {
+			r.AddAttrs(slog.Int64("user_id", f.userID))
+		}
+		if f.sessionID != 0 {
+			r.AddAttrs(slog.Int64("session_id", f.sessionID))
+		}
+		f.mu.Unlock()
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestLoggerCorrelationAndRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, slog.LevelInfo, "json")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx := NewContext(context.Background(), "req-1")
+	SetUser(ctx, 42)
+	SetSession(ctx, 7)
+	logger.InfoContext(ctx, "signed in",
+		"password", "hunter2",
+		slog.Group("headers", "Authorization", "Bearer abc", "Accept", "text/html"),
+	)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+
+	if line["request_id"] != "req-1" || line["user_id"] != float64(42) || line["session_id"] != float64(7) {
+		t.Errorf("correlation fields missing: %v", line)
+	}
+	if line["password"] != redacted {
+		t.Errorf("password = %v, want redacted", line["password"])
+	}
+	headers, _ := line["headers"].(map[string]interface{})
+	if headers["Authorization"] != redacted || headers["Accept"] != "text/html" {
+		t.Errorf("headers = %v, want Authorization redacted only", headers)
+	}
+
+	buf.Reset()
+	logger.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("debug line written at info level: %s", buf.String())
+	}
+}
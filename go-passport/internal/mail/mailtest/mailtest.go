@@ -0,0 +1,51 @@
+// Package mailtest provides a mailer for tests that records messages
+// instead of delivering them.
+package mailtest
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oceanheart/go-passport/internal/mail"
+)
+
+// Recorder keeps sent messages instead of delivering them.
+type Recorder struct {
+	Sent []mail.Message
+}
+
+func (r *Recorder) Send(ctx context.Context, msg mail.Message) error {
+	r.Sent = append(r.Sent, msg)
+	return nil
+}
+
+// Last returns the last message sent, failing the test if there's none.
+func (r *Recorder) Last(t testing.TB) mail.Message {
+	t.Helper()
+	if len(r.Sent) == 0 {
+		t.Fatal("no messages sent")
+	}
+	return r.Sent[len(r.Sent)-1]
+}
+
+// LinkToken returns the token query parameter of the first link in body
+// that has one.
+func LinkToken(t testing.TB, body string) string {
+	t.Helper()
+	for _, field := range strings.Fields(body) {
+		if !strings.HasPrefix(field, "http://") && !strings.HasPrefix(field, "https://") {
+			continue
+		}
+		link, err := url.Parse(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token := link.Query().Get("token"); token != "" {
+			return token
+		}
+	}
+	t.Fatalf("no link with a token in %q", body)
+	return ""
+}
@@ -0,0 +1,207 @@
+// Package metrics exposes Prometheus metrics for HTTP traffic, authentication
+// and the database pool. A nil *Metrics is valid and records nothing.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/oceanheart/go-passport/internal/cache"
+)
+
+const namespace = "passport"
+
+// Sign-in results recorded by SignIn.
+const (
+	SignInSuccess       = "success"
+	SignInUnknownEmail  = "unknown_email"
+	SignInWrongPassword = "wrong_password"
+	SignInError         = "error"
+)
+
+type Metrics struct {
+	registry     *prometheus.Registry
+	httpDuration *prometheus.HistogramVec
+	signIns      *prometheus.CounterVec
+	signUps      *prometheus.CounterVec
+	refreshes    *prometheus.CounterVec
+	tokenErrors  *prometheus.CounterVec
+	rateLimited  *prometheus.CounterVec
+}
+
+// New registers all collectors, including Go runtime metrics and the
+// connection pool statistics of db (if not nil), on a dedicated registry.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by chi route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		signIns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sign_ins_total",
+			Help:      "Sign-in attempts by result.",
+		}, []string{"result"}),
+		signUps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sign_ups_total",
+			Help:      "Sign-up attempts by result.",
+		}, []string{"result"}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refreshes_total",
+			Help:      "JWT refreshes by result.",
+		}, []string{"result"}),
+		tokenErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validation_errors_total",
+			Help:      "Rejected JWTs by reason.",
+		}, []string{"reason"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Requests rejected by the rate limiter, by route.",
+		}, []string{"route"}),
+	}
+
+	m.registry.MustRegister(
+		m.httpDuration,
+		m.signIns,
+		m.signUps,
+		m.refreshes,
+		m.tokenErrors,
+		m.rateLimited,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	}
+
+	return m
+}
+
+// RegisterCache exports the counters of a cache, read from stats at
+// scrape time and labelled with name.
+func (m *Metrics) RegisterCache(name string, stats func() cache.Stats) {
+	if m == nil {
+		return
+	}
+
+	labels := prometheus.Labels{"cache": name}
+	counter := func(metric, help string, value func(cache.Stats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        metric,
+			Help:        help,
+			ConstLabels: labels,
+		}, func() float64 { return float64(value(stats())) })
+	}
+
+	m.registry.MustRegister(
+		counter("cache_hits_total", "Auth cache hits.", func(s cache.Stats) uint64 { return s.Hits }),
+		counter("cache_misses_total", "Auth cache misses.", func(s cache.Stats) uint64 { return s.Misses }),
+		counter("cache_evictions_total", "Auth cache evictions.", func(s cache.Stats) uint64 { return s.Evictions }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "cache_entries",
+			Help:        "Entries currently held in the auth cache.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(stats().Size) }),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Instrument records request latency labelled with the matched chi route
+// pattern (e.g. "/admin/users/{id}"), keeping label cardinality bounded.
+func (m *Metrics) Instrument(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		m.httpDuration.WithLabelValues(methodLabel(r.Method), route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+func (m *Metrics) SignIn(result string) {
+	if m == nil {
+		return
+	}
+	m.signIns.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) SignUp(success bool) {
+	if m == nil {
+		return
+	}
+	m.signUps.WithLabelValues(resultLabel(success)).Inc()
+}
+
+func (m *Metrics) TokenRefresh(success bool) {
+	if m == nil {
+		return
+	}
+	m.refreshes.WithLabelValues(resultLabel(success)).Inc()
+}
+
+func (m *Metrics) TokenValidationError(reason string) {
+	if m == nil {
+		return
+	}
+	m.tokenErrors.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) RateLimited(route string) {
+	if m == nil {
+		return
+	}
+	m.rateLimited.WithLabelValues(route).Inc()
+}
+
+// methodLabel returns method if it is a standard HTTP method and "OTHER"
+// otherwise, since clients can send any method and each would add series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+func resultLabel(success bool) string {
+	if success {
+		return "success"
+	}
+	return "failure"
+}
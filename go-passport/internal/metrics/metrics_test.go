@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestInstrumentLabelsRoutePattern(t *testing.T) {
+	m := New(nil)
+
+	r := chi.NewRouter()
+	r.Use(m.Instrument)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("X-RANDOM-1234", "/missing", nil))
+	m.SignIn(SignInWrongPassword)
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`passport_http_request_duration_seconds_count{method="GET",route="/users/{id}",status="418"} 2`,
+		`passport_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+		`passport_http_request_duration_seconds_count{method="OTHER",route="unmatched",status="405"} 1`,
+		`passport_sign_ins_total{result="wrong_password"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.SignIn(SignInSuccess)
+	m.RateLimited("sign_in")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if got := m.Instrument(handler); got == nil {
+		t.Fatal("Instrument on nil Metrics returned nil handler")
+	}
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
@@ -2,11 +2,17 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/logging"
+	"github.com/oceanheart/go-passport/internal/metrics"
 	"github.com/oceanheart/go-passport/internal/models"
 	"github.com/oceanheart/go-passport/internal/service"
 )
@@ -17,23 +23,29 @@ const (
 	UserContextKey    contextKey = "user"
 	SessionContextKey contextKey = "session"
 	ClaimsContextKey  contextKey = "claims"
+
+	// bearerAuthContextKey marks requests authenticated by a valid bearer
+	// token rather than a cookie
+	bearerAuthContextKey contextKey = "bearer_auth"
 )
 
 type AuthMiddleware struct {
 	authService *service.AuthService
 	jwtService  *auth.JWTService
+	metrics     *metrics.Metrics
 }
 
-func NewAuthMiddleware(authService *service.AuthService, jwtService *auth.JWTService) *AuthMiddleware {
+func NewAuthMiddleware(authService *service.AuthService, jwtService *auth.JWTService, metrics *metrics.Metrics) *AuthMiddleware {
 	return &AuthMiddleware{
 		authService: authService,
 		jwtService:  jwtService,
+		metrics:     metrics,
 	}
 }
 
-func (m *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		user, _, err := m.extractAuth(r)
+func (m *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := m.currentUser(r)
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -44,13 +56,13 @@ func (m *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (m *AuthMiddleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		user, _, err := m.extractAuth(r)
+func (m *AuthMiddleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := m.currentUser(r)
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -61,15 +73,22 @@ func (m *AuthMiddleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (m *AuthMiddleware) ExtractAuth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		user, claims, _ := m.extractAuth(r)
-		
+func (m *AuthMiddleware) ExtractAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, claims := m.bearerAuth(r)
 		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), bearerAuthContextKey, true))
+		} else {
+			user, claims = m.cookieAuth(r)
+		}
+
+		if user != nil {
+			logging.SetUser(r.Context(), user.ID)
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.EnduserID(strconv.FormatInt(user.ID, 10)))
 			ctx := context.WithValue(r.Context(), UserContextKey, user)
 			r = r.WithContext(ctx)
 		}
@@ -79,40 +98,73 @@ func (m *AuthMiddleware) ExtractAuth(next http.HandlerFunc) http.HandlerFunc {
 			r = r.WithContext(ctx)
 		}
 
-		next(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentUser reuses the user already resolved by ExtractAuth, only hitting
+// the token/session lookup when the route isn't behind ExtractAuth.
+func (m *AuthMiddleware) currentUser(r *http.Request) (*models.User, error) {
+	if user := GetUser(r.Context()); user != nil {
+		return user, nil
 	}
+
+	user, _, err := m.extractAuth(r)
+	return user, err
 }
 
 func (m *AuthMiddleware) extractAuth(r *http.Request) (*models.User, *auth.Claims, error) {
 	// Try JWT from Authorization header first
+	if user, claims := m.bearerAuth(r); user != nil {
+		return user, claims, nil
+	}
+
+	user, claims := m.cookieAuth(r)
+	return user, claims, nil
+}
+
+// bearerAuth authenticates the request by the JWT in its Authorization
+// header.
+func (m *AuthMiddleware) bearerAuth(r *http.Request) (*models.User, *auth.Claims) {
 	if token := extractBearerToken(r); token != "" {
-		claims, err := m.jwtService.ValidateToken(token)
+		claims, err := m.validateToken(token)
 		if err == nil {
-			user, err := m.authService.GetUserFromToken(r.Context(), token)
+			user, err := m.authService.GetUserFromClaims(r.Context(), claims)
 			if err == nil {
-				return user, claims, nil
+				return user, claims
 			}
 		}
 	}
+	return nil, nil
+}
+
+// bearerAuthenticated reports whether ExtractAuth authenticated r by its
+// bearer token.
+func bearerAuthenticated(r *http.Request) bool {
+	bearer, _ := r.Context().Value(bearerAuthContextKey).(bool)
+	return bearer
+}
 
+// cookieAuth authenticates the request by one of the session cookies.
+func (m *AuthMiddleware) cookieAuth(r *http.Request) (*models.User, *auth.Claims) {
 	// Try JWT from oh_session cookie
 	if cookie, err := r.Cookie("oh_session"); err == nil && cookie.Value != "" {
-		claims, err := m.jwtService.ValidateToken(cookie.Value)
+		claims, err := m.validateToken(cookie.Value)
 		if err == nil {
-			user, err := m.authService.GetUserFromToken(r.Context(), cookie.Value)
+			user, err := m.authService.GetUserFromClaims(r.Context(), claims)
 			if err == nil {
-				return user, claims, nil
+				return user, claims
 			}
 		}
 	}
 
 	// Try legacy jwt_token cookie
 	if cookie, err := r.Cookie("jwt_token"); err == nil && cookie.Value != "" {
-		claims, err := m.jwtService.ValidateToken(cookie.Value)
+		claims, err := m.validateToken(cookie.Value)
 		if err == nil {
-			user, err := m.authService.GetUserFromToken(r.Context(), cookie.Value)
+			user, err := m.authService.GetUserFromClaims(r.Context(), claims)
 			if err == nil {
-				return user, claims, nil
+				return user, claims
 			}
 		}
 	}
@@ -123,12 +175,26 @@ func (m *AuthMiddleware) extractAuth(r *http.Request) (*models.User, *auth.Claim
 		if err == nil {
 			user, err := m.authService.GetUserFromSession(r.Context(), sessionID)
 			if err == nil {
-				return user, nil, nil
+				logging.SetSession(r.Context(), sessionID)
+				return user, nil
 			}
 		}
 	}
 
-	return nil, nil, nil
+	return nil, nil
+}
+
+// validateToken checks a presented JWT, counting rejections by reason.
+func (m *AuthMiddleware) validateToken(token string) (*auth.Claims, error) {
+	claims, err := m.jwtService.ValidateToken(token)
+	if err != nil {
+		reason := "invalid"
+		if errors.Is(err, auth.ErrTokenExpired) {
+			reason = "expired"
+		}
+		m.metrics.TokenValidationError(reason)
+	}
+	return claims, err
 }
 
 func extractBearerToken(r *http.Request) string {
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/oceanheart/go-passport/internal/clientip"
+)
+
+const ClientIPContextKey contextKey = "client_ip"
+
+// ResolveClientIP stores the client IP determined by resolver in the request
+// context so rate limiting, sessions and logging all agree on it.
+func ResolveClientIP(resolver *clientip.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ClientIPContextKey, resolver.Resolve(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetClientIP returns the IP resolved by ResolveClientIP, falling back to
+// the connection's remote address when the middleware didn't run.
+func GetClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPContextKey).(string); ok {
+		return ip
+	}
+	return (&clientip.Resolver{}).Resolve(r)
+}
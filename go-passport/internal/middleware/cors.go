@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CORSPolicy describes which cross-origin requests a route group accepts.
+// Origins are exact ("https://watson.oceanheart.ai") or match any subdomain
+// ("https://*.oceanheart.ai"); scheme and port must always match.
+type CORSPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORSMiddleware applies a policy that can be replaced at runtime with
+// Update, e.g. on a configuration reload.
+type CORSMiddleware struct {
+	rules atomic.Pointer[corsRules]
+}
+
+// corsRules is a policy compiled for matching.
+type corsRules struct {
+	policy   CORSPolicy
+	exact    map[string]bool
+	patterns []originPattern
+	methods  map[string]bool
+	headers  map[string]bool
+}
+
+// originPattern matches "scheme://<one or more labels>.suffix[:port]".
+type originPattern struct {
+	scheme string
+	suffix string
+	port   string
+}
+
+func NewCORSMiddleware(policy CORSPolicy) (*CORSMiddleware, error) {
+	m := &CORSMiddleware{}
+	if err := m.Update(policy); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Update replaces the policy. An invalid policy is rejected and the current
+// one kept.
+func (m *CORSMiddleware) Update(policy CORSPolicy) error {
+	rules, err := compileCORSPolicy(policy)
+	if err != nil {
+		return err
+	}
+	m.rules.Store(rules)
+	return nil
+}
+
+func compileCORSPolicy(policy CORSPolicy) (*corsRules, error) {
+	m := &corsRules{
+		policy:  policy,
+		exact:   make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+
+	for _, origin := range policy.AllowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid CORS origin %q", origin)
+		}
+
+		host := u.Hostname()
+		if !strings.HasPrefix(host, "*.") {
+			if strings.Contains(host, "*") {
+				return nil, fmt.Errorf("invalid CORS origin %q: wildcard must be a leading subdomain", origin)
+			}
+			m.exact[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+			continue
+		}
+
+		m.patterns = append(m.patterns, originPattern{
+			scheme: strings.ToLower(u.Scheme),
+			suffix: strings.ToLower(host[1:]),
+			port:   u.Port(),
+		})
+	}
+
+	for _, method := range policy.AllowedMethods {
+		m.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range policy.AllowedHeaders {
+		m.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return m, nil
+}
+
+func (m *CORSMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		rules := m.rules.Load()
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			// Answer preflights here so they never reach auth or handlers;
+			// leaving out the CORS headers is how a preflight is refused.
+			if rules.allowsOrigin(origin) && rules.allowsPreflight(r) {
+				rules.setOriginHeaders(h, origin)
+				h.Set("Access-Control-Allow-Methods", strings.Join(rules.policy.AllowedMethods, ", "))
+				if len(rules.policy.AllowedHeaders) > 0 {
+					h.Set("Access-Control-Allow-Headers", strings.Join(rules.policy.AllowedHeaders, ", "))
+				}
+				if rules.policy.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(int(rules.policy.MaxAge.Seconds())))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if rules.allowsOrigin(origin) {
+			rules.setOriginHeaders(h, origin)
+			if len(rules.policy.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(rules.policy.ExposedHeaders, ", "))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AllowsOrigin reports whether origin matches the policy.
+func (m *CORSMiddleware) AllowsOrigin(origin string) bool {
+	return m.rules.Load().allowsOrigin(origin)
+}
+
+func (m *corsRules) allowsOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.User != nil {
+		return false
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if m.exact[scheme+"://"+strings.ToLower(u.Host)] {
+		return true
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, p := range m.patterns {
+		if scheme == p.scheme && u.Port() == p.port &&
+			strings.HasSuffix(host, p.suffix) && len(host) > len(p.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *corsRules) allowsPreflight(r *http.Request) bool {
+	if !m.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] {
+		return false
+	}
+
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !m.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *corsRules) setOriginHeaders(h http.Header, origin string) {
+	// Always echo the origin rather than "*", which browsers reject for
+	// credentialed requests
+	h.Set("Access-Control-Allow-Origin", origin)
+	if m.policy.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
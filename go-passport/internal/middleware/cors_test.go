@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSAllowsOrigin(t *testing.T) {
+	cors, err := NewCORSMiddleware(CORSPolicy{
+		AllowedOrigins: []string{"https://oceanheart.ai", "https://*.oceanheart.ai", "http://*.lvh.me:3000"},
+	})
+	if err != nil {
+		t.Fatalf("NewCORSMiddleware() error = %v", err)
+	}
+
+	tests := map[string]bool{
+		"https://oceanheart.ai":            true,
+		"https://watson.oceanheart.ai":     true,
+		"https://a.b.oceanheart.ai":        true,
+		"http://watson.oceanheart.ai":      false,
+		"https://watson.oceanheart.ai:444": false,
+		"https://evil-oceanheart.ai":       false,
+		"https://oceanheart.ai.evil.com":   false,
+		"http://notebook.lvh.me:3000":      true,
+		"http://notebook.lvh.me":           false,
+		"null":                             false,
+	}
+	for origin, want := range tests {
+		if got := cors.AllowsOrigin(origin); got != want {
+			t.Errorf("AllowsOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	cors, err := NewCORSMiddleware(CORSPolicy{
+		AllowedOrigins:   []string{"https://*.oceanheart.ai"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+	})
+	if err != nil {
+		t.Fatalf("NewCORSMiddleware() error = %v", err)
+	}
+	handler := cors.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("preflight reached the handler")
+	}))
+
+	preflight := func(origin, method, headers string) http.Header {
+		req := httptest.NewRequest(http.MethodOptions, "/api/auth/signin", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", headers)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want 204", rec.Code)
+		}
+		return rec.Header()
+	}
+
+	h := preflight("https://watson.oceanheart.ai", "POST", "content-type, authorization")
+	if h.Get("Access-Control-Allow-Origin") != "https://watson.oceanheart.ai" || h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("allowed preflight headers = %v", h)
+	}
+
+	if h := preflight("https://watson.oceanheart.ai", "DELETE", ""); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Error("preflight with disallowed method was allowed")
+	}
+	if h := preflight("https://watson.oceanheart.ai", "POST", "X-Custom"); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Error("preflight with disallowed header was allowed")
+	}
+	if h := preflight("https://evil.example", "POST", ""); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Error("preflight from disallowed origin was allowed")
+	}
+}
+
+func TestCORSUpdateKeepsPolicyOnError(t *testing.T) {
+	cors, err := NewCORSMiddleware(CORSPolicy{AllowedOrigins: []string{"https://oceanheart.ai"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cors.Update(CORSPolicy{AllowedOrigins: []string{"https://evil.*"}}); err == nil {
+		t.Fatal("Update() accepted an invalid origin")
+	}
+	if !cors.AllowsOrigin("https://oceanheart.ai") {
+		t.Error("rejected update replaced the policy")
+	}
+
+	if err := cors.Update(CORSPolicy{AllowedOrigins: []string{"https://watson.oceanheart.ai"}}); err != nil {
+		t.Fatal(err)
+	}
+	if cors.AllowsOrigin("https://oceanheart.ai") || !cors.AllowsOrigin("https://watson.oceanheart.ai") {
+		t.Error("Update() didn't replace the policy")
+	}
+}
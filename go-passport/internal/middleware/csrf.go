@@ -5,8 +5,10 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
 )
 
 type CSRFMiddleware struct {
@@ -19,11 +21,11 @@ func NewCSRFMiddleware(secret string) *CSRFMiddleware {
 	}
 }
 
-func (m *CSRFMiddleware) Protect(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func (m *CSRFMiddleware) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip CSRF for API endpoints (they use JWT)
 		if isAPIRequest(r) {
-			next(w, r)
+			next.ServeHTTP(w, r)
 			return
 		}
 
@@ -32,7 +34,7 @@ func (m *CSRFMiddleware) Protect(next http.HandlerFunc) http.HandlerFunc {
 			// Safe methods don't require CSRF token
 			token := m.generateToken()
 			setCSRFCookie(w, token)
-			next(w, r)
+			next.ServeHTTP(w, r)
 			return
 		}
 
@@ -53,10 +55,79 @@ func (m *CSRFMiddleware) Protect(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		next(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ProtectAPI guards API routes, which Protect skips, against cross-site
+// requests riding on session cookies. State-changing requests that carry
+// an auth cookie must prove they came from us or a trusted origin: via
+// Sec-Fetch-Site, Origin (or Referer), or a valid X-CSRF-Token header.
+// Only requests that AuthMiddleware.ExtractAuth, running before this,
+// authenticated by bearer token are exempt. Merely sending an Authorization
+// header isn't enough, since an invalid token falls back to the cookies.
+func (m *CSRFMiddleware) ProtectAPI(trustedOrigins *CORSMiddleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "GET", "HEAD", "OPTIONS", "TRACE":
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if bearerAuthenticated(r) || !hasAuthCookie(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !m.verifyAPIOrigin(r, trustedOrigins) {
+				writeAPIError(w, "Cross-site request rejected", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
+func (m *CSRFMiddleware) verifyAPIOrigin(r *http.Request, trustedOrigins *CORSMiddleware) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "same-origin" {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		// Some browsers omit Origin; the Referer's origin serves instead
+		if referer, err := url.Parse(r.Header.Get("Referer")); err == nil && referer.Host != "" {
+			origin = referer.Scheme + "://" + referer.Host
+		} else {
+			origin = ""
+		}
+	}
+	if origin != "" {
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		if trustedOrigins.AllowsOrigin(origin) {
+			return true
+		}
+	}
+
+	cookieToken, _ := getCSRFCookie(r)
+	return m.validateToken(cookieToken, r.Header.Get("X-CSRF-Token"))
+}
+
+// hasAuthCookie reports whether the request carries any cookie extractAuth
+// would authenticate with.
+func hasAuthCookie(r *http.Request) bool {
+	for _, name := range []string{"oh_session", "jwt_token", "session_id"} {
+		if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *CSRFMiddleware) generateToken() string {
 	// Generate random bytes
 	b := make([]byte, 32)
@@ -135,6 +206,15 @@ func isAPIRequest(r *http.Request) bool {
 	return len(path) >= 5 && path[:5] == "/api/"
 }
 
+func writeAPIError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   message,
+	})
+}
+
 func isSecure() bool {
 	// TODO: Get from config
 	return false
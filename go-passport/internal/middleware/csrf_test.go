@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtectAPI(t *testing.T) {
+	csrf := NewCSRFMiddleware("secret")
+	cors, err := NewCORSMiddleware(CORSPolicy{AllowedOrigins: []string{"https://*.oceanheart.ai"}})
+	if err != nil {
+		t.Fatalf("NewCORSMiddleware() error = %v", err)
+	}
+	handler := csrf.ProtectAPI(cors)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	token := csrf.generateToken()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		cookies map[string]string
+		bearer  bool
+		want    int
+	}{
+		{"no cookies", nil, nil, false, http.StatusNoContent},
+		{"bearer authenticated", map[string]string{"Authorization": "Bearer valid"}, map[string]string{"oh_session": "x"}, true, http.StatusNoContent},
+		{"invalid bearer token", map[string]string{"Authorization": "Bearer x"}, map[string]string{"oh_session": "x"}, false, http.StatusForbidden},
+		{"cookie without proof", nil, map[string]string{"oh_session": "x"}, false, http.StatusForbidden},
+		{"cross-site origin", map[string]string{"Origin": "https://evil.example"}, map[string]string{"session_id": "1"}, false, http.StatusForbidden},
+		{"same origin", map[string]string{"Origin": "https://passport.oceanheart.ai"}, map[string]string{"oh_session": "x"}, false, http.StatusNoContent},
+		{"trusted origin", map[string]string{"Origin": "https://watson.oceanheart.ai"}, map[string]string{"oh_session": "x"}, false, http.StatusNoContent},
+		{"sec-fetch-site", map[string]string{"Sec-Fetch-Site": "same-origin"}, map[string]string{"oh_session": "x"}, false, http.StatusNoContent},
+		{"referer", map[string]string{"Referer": "https://watson.oceanheart.ai/app"}, map[string]string{"oh_session": "x"}, false, http.StatusNoContent},
+		{"csrf header", map[string]string{"X-CSRF-Token": token}, map[string]string{"oh_session": "x", "csrf_token": token}, false, http.StatusNoContent},
+		{"wrong csrf header", map[string]string{"X-CSRF-Token": "nope"}, map[string]string{"oh_session": "x", "csrf_token": token}, false, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "https://passport.oceanheart.ai/api/auth/signout", nil)
+			if tt.bearer {
+				req = req.WithContext(context.WithValue(req.Context(), bearerAuthContextKey, true))
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			for k, v := range tt.cookies {
+				req.AddCookie(&http.Cookie{Name: k, Value: v})
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
 	"time"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/oceanheart/go-passport/internal/logging"
 )
 
 type responseWriter struct {
@@ -23,38 +28,57 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
-func Logging(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		
-		wrapped := &responseWriter{
-			ResponseWriter: w,
-			status:        200,
-		}
-		
-		next(wrapped, r)
-		
-		log.Printf(
-			"%s %s %s %d %d %v",
-			r.RemoteAddr,
-			r.Method,
-			r.URL.Path,
-			wrapped.status,
-			wrapped.size,
-			time.Since(start),
-		)
+// Logging writes one structured line per request and sets up the request's
+// log correlation fields (request ID, plus user and session once
+// authenticated) for everything logged while handling it.
+func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := chimw.GetReqID(r.Context())
+			if requestID != "" {
+				w.Header().Set("X-Request-ID", requestID)
+			}
+			r = r.WithContext(logging.NewContext(r.Context(), requestID))
+
+			wrapped := &responseWriter{
+				ResponseWriter: w,
+				status:         200,
+			}
+
+			next.ServeHTTP(wrapped, r)
+
+			level := slog.LevelInfo
+			if wrapped.status >= 500 {
+				level = slog.LevelError
+			}
+
+			// Only the path is logged: query strings can carry tokens
+			logger.Log(r.Context(), level, "request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", wrapped.status,
+				"bytes", wrapped.size,
+				"duration_ms", time.Since(start).Milliseconds(),
+				"ip", GetClientIP(r),
+				"user_agent", r.UserAgent(),
+			)
+		})
 	}
 }
 
-func Recovery(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				log.Printf("panic: %v", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
-		}()
-		
-		next(w, r)
+func Recovery(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					logger.ErrorContext(r.Context(), "panic", "error", err, "stack", string(debug.Stack()))
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		})
 	}
-}
\ No newline at end of file
+}
@@ -1,57 +1,68 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/oceanheart/go-passport/internal/metrics"
 )
 
 type RateLimiter struct {
-	mu      sync.Mutex
-	buckets map[string]*tokenBucket
-	rate    int
-	window  time.Duration
-}
-
-type tokenBucket struct {
-	tokens    int
-	lastRefill time.Time
+	store    RateLimitStore
+	policies atomic.Pointer[map[string][]RateLimitPolicy]
+	logger   *slog.Logger
+	metrics  *metrics.Metrics
 }
 
-func NewRateLimiter(rate int, window time.Duration) *RateLimiter {
+func NewRateLimiter(store RateLimitStore, policies map[string][]RateLimitPolicy, logger *slog.Logger, metrics *metrics.Metrics) *RateLimiter {
 	rl := &RateLimiter{
-		buckets: make(map[string]*tokenBucket),
-		rate:    rate,
-		window:  window,
+		store:   store,
+		logger:  logger,
+		metrics: metrics,
 	}
-
-	// Start cleanup goroutine
-	go rl.cleanup()
-
+	rl.SetPolicies(policies)
 	return rl
 }
 
-func (rl *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		clientIP := getClientIP(r)
-		
-		if !rl.Allow(clientIP) {
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-			return
-		}
-
-		next(w, r)
-	}
+// SetPolicies replaces the policies of every route, e.g. on a configuration
+// reload. Requests already being checked finish with the old policies.
+func (rl *RateLimiter) SetPolicies(policies map[string][]RateLimitPolicy) {
+	rl.policies.Store(&policies)
 }
 
-func (rl *RateLimiter) LimitEndpoint(endpoint string) func(http.HandlerFunc) http.HandlerFunc {
+// LimitEndpoint applies the policies configured for route. Every policy is
+// counted and the most restrictive result decides the response; routes
+// without policies are not limited.
+func (rl *RateLimiter) LimitEndpoint(route string) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			clientIP := getClientIP(r)
-			key := endpoint + ":" + clientIP
-			
-			if !rl.Allow(key) {
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			policies := (*rl.policies.Load())[route]
+			if len(policies) == 0 {
+				next(w, r)
+				return
+			}
+
+			result, applied := rl.check(r, route, policies)
+			if !applied {
+				next(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w, result)
+			if !result.Allowed {
+				rl.logger.WarnContext(r.Context(), "rate limited", "route", route, "retry_after", result.RetryAfter)
+				rl.metrics.RateLimited(route)
+				writeRateLimited(w, r, result)
 				return
 			}
 
@@ -60,77 +71,127 @@ func (rl *RateLimiter) LimitEndpoint(endpoint string) func(http.HandlerFunc) htt
 	}
 }
 
-func (rl *RateLimiter) Allow(key string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// check counts the request against each policy it can be keyed on. If the
+// store is unavailable the policy is skipped: an outage of the shared store
+// shouldn't lock everyone out of signing in.
+func (rl *RateLimiter) check(r *http.Request, route string, policies []RateLimitPolicy) (RateLimitResult, bool) {
+	var combined RateLimitResult
+	applied := false
+
+	for _, policy := range policies {
+		value, ok := policyKey(r, policy)
+		if !ok {
+			continue
+		}
+
+		key := route + ":" + policy.String() + ":" + value
+		result, err := rl.store.Allow(r.Context(), key, policy.Limit, policy.Window)
+		if err != nil {
+			rl.logger.ErrorContext(r.Context(), "rate limit check failed", "route", route, "policy", policy.String(), "error", err)
+			continue
+		}
+
+		if !applied || moreRestrictive(result, combined) {
+			combined = result
+		}
+		applied = true
+	}
 
-	bucket, exists := rl.buckets[key]
-	now := time.Now()
+	return combined, applied
+}
 
-	if !exists {
-		// Create new bucket
-		rl.buckets[key] = &tokenBucket{
-			tokens:     rl.rate - 1,
-			lastRefill: now,
+// policyKey joins the request's values for each of the policy's
+// dimensions. It reports false if any of them is missing, e.g. no email
+// was submitted.
+func policyKey(r *http.Request, policy RateLimitPolicy) (string, bool) {
+	values := make([]string, 0, len(policy.Dimensions))
+	for _, dimension := range policy.Dimensions {
+		var value string
+		switch dimension {
+		case RateLimitByIP:
+			value = GetClientIP(r)
+		case RateLimitByEmail:
+			value = requestEmail(r)
+		case RateLimitByUser:
+			if user := GetUser(r.Context()); user != nil {
+				value = strconv.FormatInt(user.ID, 10)
+			}
+		}
+		if value == "" {
+			return "", false
 		}
-		return true
+		values = append(values, value)
 	}
+	return strings.Join(values, "|"), true
+}
+
+// maxEmailBodySize is how much of a JSON body requestEmail looks at.
+const maxEmailBodySize = 1 << 20
 
-	// Calculate elapsed time and refill tokens
-	elapsed := now.Sub(bucket.lastRefill)
-	tokensToAdd := int(elapsed / (rl.window / time.Duration(rl.rate)))
-	
-	if tokensToAdd > 0 {
-		bucket.tokens = min(rl.rate, bucket.tokens + tokensToAdd)
-		bucket.lastRefill = now
+// requestEmail reads the submitted email from a form or JSON body, leaving
+// the whole body readable for the handler.
+func requestEmail(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return strings.ToLower(strings.TrimSpace(r.FormValue("email")))
 	}
 
-	// Check if request is allowed
-	if bucket.tokens > 0 {
-		bucket.tokens--
-		return true
+	if r.Body == nil {
+		return ""
+	}
+	original := r.Body
+	body, err := io.ReadAll(io.LimitReader(original, maxEmailBodySize))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), original), original}
+	if err != nil {
+		return ""
 	}
 
-	return false
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Email))
 }
 
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		
-		// Remove buckets that haven't been used for 2x the window duration
-		for key, bucket := range rl.buckets {
-			if now.Sub(bucket.lastRefill) > 2 * rl.window {
-				delete(rl.buckets, key)
-			}
-		}
-		
-		rl.mu.Unlock()
+// moreRestrictive reports whether a should be reported instead of b:
+// denials win, then the longer wait, then the fewer remaining requests.
+func moreRestrictive(a, b RateLimitResult) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
 	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
 }
 
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
+func setRateLimitHeaders(w http.ResponseWriter, result RateLimitResult) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
 	}
+}
 
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+func writeRateLimited(w http.ResponseWriter, r *http.Request, result RateLimitResult) {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
 	}
 
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
+	message := fmt.Sprintf("Too many requests, retry in %d seconds", max(ceilSeconds(result.RetryAfter), 1))
+	writeAPIError(w, message, http.StatusTooManyRequests)
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
\ No newline at end of file
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// readCloser reads from Reader and closes Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
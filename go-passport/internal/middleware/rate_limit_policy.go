@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitDimension is a request attribute a limit can be keyed on.
+type RateLimitDimension string
+
+const (
+	RateLimitByIP    RateLimitDimension = "ip"
+	RateLimitByEmail RateLimitDimension = "email"
+	RateLimitByUser  RateLimitDimension = "user"
+)
+
+// RateLimitPolicy allows Limit requests per Window for each distinct
+// combination of its dimensions' values, so "ip+email" counts every
+// address/email pair separately.
+type RateLimitPolicy struct {
+	Dimensions []RateLimitDimension
+	Limit      int
+	Window     time.Duration
+}
+
+// String formats the policy in the syntax accepted by
+// ParseRateLimitPolicies, e.g. "ip+email:5/3m0s".
+func (p RateLimitPolicy) String() string {
+	dimensions := make([]string, len(p.Dimensions))
+	for i, dimension := range p.Dimensions {
+		dimensions[i] = string(dimension)
+	}
+	return fmt.Sprintf("%s:%d/%s", strings.Join(dimensions, "+"), p.Limit, p.Window)
+}
+
+// ParseRateLimitPolicies parses per-route policies of the form
+//
+//	sign_in=ip:10/3m,email:20/15m;sign_up=ip:5/1h
+//
+// Routes are separated by ";", a route's policies by ",", and dimensions
+// within a policy by "+".
+func ParseRateLimitPolicies(spec string) (map[string][]RateLimitPolicy, error) {
+	policies := make(map[string][]RateLimitPolicy)
+
+	for _, routeSpec := range strings.Split(spec, ";") {
+		routeSpec = strings.TrimSpace(routeSpec)
+		if routeSpec == "" {
+			continue
+		}
+
+		route, list, ok := strings.Cut(routeSpec, "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("invalid rate limit route %q: expected route=policies", routeSpec)
+		}
+
+		for _, policySpec := range strings.Split(list, ",") {
+			policy, err := parseRateLimitPolicy(strings.TrimSpace(policySpec))
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate limit policy for %s: %w", route, err)
+			}
+			policies[route] = append(policies[route], policy)
+		}
+	}
+
+	return policies, nil
+}
+
+func parseRateLimitPolicy(spec string) (RateLimitPolicy, error) {
+	dimensionList, rate, ok := strings.Cut(spec, ":")
+	if !ok {
+		return RateLimitPolicy{}, fmt.Errorf("%q: expected dimensions:limit/window", spec)
+	}
+
+	var policy RateLimitPolicy
+	for _, name := range strings.Split(dimensionList, "+") {
+		dimension := RateLimitDimension(strings.TrimSpace(name))
+		switch dimension {
+		case RateLimitByIP, RateLimitByEmail, RateLimitByUser:
+			policy.Dimensions = append(policy.Dimensions, dimension)
+		default:
+			return RateLimitPolicy{}, fmt.Errorf("%q: unknown dimension %q", spec, dimension)
+		}
+	}
+
+	limit, window, ok := strings.Cut(rate, "/")
+	if !ok {
+		return RateLimitPolicy{}, fmt.Errorf("%q: expected dimensions:limit/window", spec)
+	}
+
+	var err error
+	if policy.Limit, err = strconv.Atoi(strings.TrimSpace(limit)); err != nil || policy.Limit <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("%q: limit must be a positive integer", spec)
+	}
+	if policy.Window, err = time.ParseDuration(strings.TrimSpace(window)); err != nil || policy.Window <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("%q: window must be a positive duration", spec)
+	}
+	// Stores space requests window/limit apart, which must not round to zero;
+	// the Postgres store counts in microseconds
+	if policy.Window/time.Duration(policy.Limit) < time.Microsecond {
+		return RateLimitPolicy{}, fmt.Errorf("%q: window must be at least a microsecond per request", spec)
+	}
+
+	return policy, nil
+}
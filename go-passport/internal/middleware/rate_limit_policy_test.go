@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitPolicies(t *testing.T) {
+	policies, err := ParseRateLimitPolicies("sign_in=ip:10/3m, ip+email:5/15m; refresh=user:30/1m")
+	if err != nil {
+		t.Fatalf("ParseRateLimitPolicies() error = %v", err)
+	}
+
+	signIn := policies["sign_in"]
+	if len(signIn) != 2 {
+		t.Fatalf("sign_in has %d policies, want 2", len(signIn))
+	}
+	if got := signIn[1].String(); got != "ip+email:5/15m0s" {
+		t.Errorf("sign_in[1] = %s, want ip+email:5/15m0s", got)
+	}
+	if refresh := policies["refresh"]; len(refresh) != 1 || refresh[0].Window != time.Minute {
+		t.Errorf("refresh = %v, want one 1m policy", refresh)
+	}
+
+	for _, spec := range []string{
+		"sign_in",
+		"sign_in=ip",
+		"sign_in=device:10/1m",
+		"sign_in=ip:0/1m",
+		"sign_in=ip:-5/1m",
+		"sign_in=ip:10/5ns",
+		"sign_in=ip:1000001/1s",
+		"sign_in=ip:10/soon",
+	} {
+		if _, err := ParseRateLimitPolicies(spec); err == nil {
+			t.Errorf("ParseRateLimitPolicies(%q) error = nil, want error", spec)
+		}
+	}
+}
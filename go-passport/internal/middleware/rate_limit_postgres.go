@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/config"
+)
+
+// PostgresRateLimitStore shares limits between instances using the generic
+// cell rate algorithm (GCRA). Each key stores a single "theoretical arrival
+// time" which is advanced by one emission interval (window/limit) per
+// allowed request; a request is allowed while that time stays within one
+// window of now. The check and update happen in a single upsert, so
+// concurrent requests on different instances can't both take the last slot.
+type PostgresRateLimitStore struct {
+	db     *config.Database
+	logger *slog.Logger
+}
+
+func NewPostgresRateLimitStore(db *config.Database, logger *slog.Logger) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db, logger: logger}
+}
+
+func (s *PostgresRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	// $2 = emission interval, $3 = window, both in microseconds. now() is
+	// the database clock, so instances with skewed clocks still agree.
+	query := `
+		INSERT INTO rate_limits AS rl (key, tat, allowed)
+		VALUES ($1, now() + $2 * interval '1 microsecond', true)
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = GREATEST(rl.tat, now()) + $2 * interval '1 microsecond'
+				<= now() + $3 * interval '1 microsecond',
+			tat = CASE
+				WHEN GREATEST(rl.tat, now()) + $2 * interval '1 microsecond'
+					<= now() + $3 * interval '1 microsecond'
+				THEN GREATEST(rl.tat, now()) + $2 * interval '1 microsecond'
+				ELSE rl.tat
+			END
+		RETURNING allowed, EXTRACT(EPOCH FROM (tat - now()))`
+
+	interval := window / time.Duration(limit)
+
+	var allowed bool
+	var ahead float64
+	err := s.db.QueryRowContext(ctx, query, key, interval.Microseconds(), window.Microseconds()).Scan(&allowed, &ahead)
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("failed to update rate limit: %w", err)
+	}
+
+	// How far the theoretical arrival time is ahead of now
+	tatAhead := time.Duration(ahead * float64(time.Second))
+
+	result := RateLimitResult{
+		Allowed:    allowed,
+		Limit:      limit,
+		Remaining:  int(math.Max(0, math.Floor(float64(window-tatAhead)/float64(interval)))),
+		ResetAfter: max(tatAhead, 0),
+	}
+	if !allowed {
+		result.RetryAfter = max(tatAhead+interval-window, 0)
+	}
+
+	return result, nil
+}
+
+// Cleanup deletes expired keys every five minutes until ctx is cancelled.
+func (s *PostgresRateLimitStore) Cleanup(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Keys whose arrival time has passed are back to a full limit
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE tat < now()`); err != nil && ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "failed to clean up rate limits", "error", err)
+		}
+	}
+}
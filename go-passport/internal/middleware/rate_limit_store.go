@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitResult describes the outcome of counting one request against a
+// limit.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is how long until the full limit is available again.
+	ResetAfter time.Duration
+	// RetryAfter is how long until the next request would be allowed. It is
+	// zero when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts requests per key. Implementations must be safe for
+// concurrent use; shared implementations make limits hold across instances.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStore keeps token buckets in a process-local map. Limits
+// are per instance, so running N replicas allows N times the traffic.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens     int
+	lastRefill time.Time
+	window     time.Duration
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (s *MemoryRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, exists := s.buckets[key]
+	now := time.Now()
+	interval := window / time.Duration(limit)
+
+	if !exists {
+		// Create new bucket
+		bucket = &tokenBucket{
+			tokens:     limit,
+			lastRefill: now,
+			window:     window,
+		}
+		s.buckets[key] = bucket
+	}
+
+	// Calculate elapsed time and refill tokens
+	elapsed := now.Sub(bucket.lastRefill)
+	tokensToAdd := int(elapsed / interval)
+
+	if tokensToAdd > 0 {
+		bucket.tokens = min(limit, bucket.tokens+tokensToAdd)
+		bucket.lastRefill = bucket.lastRefill.Add(time.Duration(tokensToAdd) * interval)
+		if bucket.tokens == limit {
+			bucket.lastRefill = now
+		}
+	}
+
+	result := RateLimitResult{Limit: limit}
+
+	// Check if request is allowed
+	if bucket.tokens > 0 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = interval - now.Sub(bucket.lastRefill)
+	}
+
+	result.Remaining = bucket.tokens
+	result.ResetAfter = time.Duration(limit-bucket.tokens)*interval - now.Sub(bucket.lastRefill)
+	if result.ResetAfter < 0 {
+		result.ResetAfter = 0
+	}
+
+	return result, nil
+}
+
+// Cleanup removes unused buckets every five minutes until ctx is cancelled.
+func (s *MemoryRateLimitStore) Cleanup(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		now := time.Now()
+
+		// Remove buckets that haven't been used for 2x the window duration
+		for key, bucket := range s.buckets {
+			if now.Sub(bucket.lastRefill) > 2*bucket.window {
+				delete(s.buckets, key)
+			}
+		}
+
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStoreAllow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Allow(ctx, "k", 3, time.Minute)
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d denied, want allowed", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("request %d Remaining = %d, want %d", i+1, result.Remaining, 2-i)
+		}
+	}
+
+	result, _ := store.Allow(ctx, "k", 3, time.Minute)
+	if result.Allowed {
+		t.Fatal("4th request allowed, want denied")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > 20*time.Second {
+		t.Errorf("RetryAfter = %v, want within one interval", result.RetryAfter)
+	}
+
+	if result, _ := store.Allow(ctx, "other", 3, time.Minute); !result.Allowed {
+		t.Error("separate key denied, want allowed")
+	}
+}
+
+func TestMemoryRateLimitStoreCleanupStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewMemoryRateLimitStore().Cleanup(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Cleanup() didn't return after ctx was cancelled")
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestEmailKeepsBody(t *testing.T) {
+	for _, size := range []int{100, maxEmailBodySize + 100} {
+		body := `{"email":" Alice@Example.com ","padding":"` + strings.Repeat("x", size) + `"}`
+		r := httptest.NewRequest("POST", "/api/auth/signin", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+
+		email := requestEmail(r)
+		if size < maxEmailBodySize && email != "alice@example.com" {
+			t.Errorf("requestEmail() = %q, want alice@example.com", email)
+		}
+		read, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(read, []byte(body)) {
+			t.Errorf("handler read %d of %d body bytes", len(read), len(body))
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oceanheart/go-passport/internal/config"
+)
+
+const CSPNonceContextKey contextKey = "csp_nonce"
+
+// SecurityHeadersMiddleware sets the response security headers. They are
+// rebuilt from the configuration by Update on a reload.
+type SecurityHeadersMiddleware struct {
+	headers atomic.Pointer[securityHeaders]
+}
+
+type securityHeaders struct {
+	hsts              string
+	cspHeader         string
+	csp               string
+	frameOptions      string
+	referrerPolicy    string
+	permissionsPolicy string
+}
+
+func NewSecurityHeadersMiddleware(cfg *config.Config) *SecurityHeadersMiddleware {
+	m := &SecurityHeadersMiddleware{}
+	m.Update(cfg)
+	return m
+}
+
+// Update rebuilds the headers from cfg.
+func (m *SecurityHeadersMiddleware) Update(cfg *config.Config) {
+	m.headers.Store(buildSecurityHeaders(cfg))
+}
+
+func buildSecurityHeaders(cfg *config.Config) *securityHeaders {
+	m := &securityHeaders{
+		cspHeader:         "Content-Security-Policy",
+		referrerPolicy:    cfg.ReferrerPolicy,
+		permissionsPolicy: cfg.PermissionsPolicy,
+	}
+
+	if cfg.HSTSMaxAge > 0 {
+		m.hsts = fmt.Sprintf("max-age=%d", int(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			m.hsts += "; includeSubDomains"
+		}
+	}
+
+	if cfg.CSPReportOnly {
+		m.cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	// Sign-in forms redirect to return_to, and browsers apply form-action
+	// to those redirects, so it mirrors the redirect allowlist. Outside
+	// production any port is allowed for local dev servers.
+	formAction := "'self'"
+	for _, host := range cfg.ReturnToAllowedHosts {
+		if cfg.CookieSecure {
+			formAction += " https://" + host
+		} else {
+			formAction += " http://" + host + ":* https://" + host + ":*"
+		}
+	}
+
+	// {nonce} is replaced per request
+	directives := []string{
+		"default-src 'self'",
+		"script-src 'self' 'nonce-{nonce}' https://cdn.tailwindcss.com",
+		// The Tailwind CDN injects <style> elements at runtime
+		"style-src 'self' 'unsafe-inline'",
+		"img-src 'self' data:",
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action " + formAction,
+		"frame-ancestors " + cfg.FrameAncestors,
+	}
+	if cfg.CSPReportURI != "" {
+		directives = append(directives, "report-uri "+cfg.CSPReportURI)
+	}
+	m.csp = strings.Join(directives, "; ")
+
+	// X-Frame-Options for browsers that predate frame-ancestors
+	switch cfg.FrameAncestors {
+	case "'none'":
+		m.frameOptions = "DENY"
+	case "'self'":
+		m.frameOptions = "SAMEORIGIN"
+	}
+
+	return m
+}
+
+func (m *SecurityHeadersMiddleware) Apply(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := generateNonce()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		m := m.headers.Load()
+		h := w.Header()
+		if m.hsts != "" {
+			h.Set("Strict-Transport-Security", m.hsts)
+		}
+		h.Set(m.cspHeader, strings.ReplaceAll(m.csp, "{nonce}", nonce))
+		h.Set("X-Content-Type-Options", "nosniff")
+		if m.frameOptions != "" {
+			h.Set("X-Frame-Options", m.frameOptions)
+		}
+		if m.referrerPolicy != "" {
+			h.Set("Referrer-Policy", m.referrerPolicy)
+		}
+		if m.permissionsPolicy != "" {
+			h.Set("Permissions-Policy", m.permissionsPolicy)
+		}
+
+		ctx := context.WithValue(r.Context(), CSPNonceContextKey, nonce)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetCSPNonce returns the nonce inline <script> elements must carry to be
+// allowed by this request's Content-Security-Policy.
+func GetCSPNonce(r *http.Request) string {
+	if nonce, ok := r.Context().Value(CSPNonceContextKey).(string); ok {
+		return nonce
+	}
+	return ""
+}
+
+func generateNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
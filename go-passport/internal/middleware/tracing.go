@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oceanheart/go-passport/internal/tracing"
+)
+
+// Tracing starts a server span per request, continuing the trace from
+// incoming W3C traceparent headers. The span is renamed after the matched
+// chi route pattern once routing is done.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(GetClientIP(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				attribute.String("request_id", chimw.GetReqID(r.Context())),
+			),
+		)
+		defer span.End()
+
+		wrapped := &responseWriter{
+			ResponseWriter: w,
+			status:         200,
+		}
+
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(wrapped.status))
+		if wrapped.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.status))
+		}
+	})
+}
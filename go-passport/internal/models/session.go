@@ -6,12 +6,17 @@ import (
 )
 
 type Session struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	IPAddress string    `json:"ip_address"`
-	UserAgent string    `json:"user_agent"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Browser    string    `json:"browser"`
+	OS         string    `json:"os"`
+	DeviceType string    `json:"device_type"`
+	Country    string    `json:"country"`
+	City       string    `json:"city"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type SessionCreateParams struct {
@@ -21,41 +26,82 @@ type SessionCreateParams struct {
 }
 
 type SessionResponse struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	IPAddress string    `json:"ip_address"`
-	UserAgent string    `json:"user_agent"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Browser    string    `json:"browser"`
+	OS         string    `json:"os"`
+	DeviceType string    `json:"device_type"`
+	Country    string    `json:"country"`
+	City       string    `json:"city"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 func (s *Session) ToResponse() SessionResponse {
 	return SessionResponse{
-		ID:        s.ID,
-		UserID:    s.UserID,
-		IPAddress: s.IPAddress,
-		UserAgent: s.UserAgent,
-		CreatedAt: s.CreatedAt,
+		ID:         s.ID,
+		UserID:     s.UserID,
+		IPAddress:  s.IPAddress,
+		UserAgent:  s.UserAgent,
+		Browser:    s.Browser,
+		OS:         s.OS,
+		DeviceType: s.DeviceType,
+		Country:    s.Country,
+		City:       s.City,
+		CreatedAt:  s.CreatedAt,
 	}
 }
 
+// DeviceSummary describes the session's device, e.g. "Chrome 120 on macOS 10.15".
+func (s *Session) DeviceSummary() string {
+	if s.Browser == "" && s.OS == "" {
+		return "Unknown device"
+	}
+	return s.Browser + " on " + s.OS
+}
+
+// Location describes where the session was created, e.g. "Berlin, DE".
+// It is empty when no GeoIP database is configured or the IP is unknown.
+func (s *Session) Location() string {
+	switch {
+	case s.City != "" && s.Country != "":
+		return s.City + ", " + s.Country
+	case s.Country != "":
+		return s.Country
+	}
+	return s.City
+}
+
 func (s *Session) Scan(rows *sql.Rows) error {
 	return rows.Scan(
 		&s.ID,
 		&s.UserID,
 		&s.IPAddress,
 		&s.UserAgent,
+		&s.Browser,
+		&s.OS,
+		&s.DeviceType,
+		&s.Country,
+		&s.City,
 		&s.CreatedAt,
 		&s.UpdatedAt,
 	)
 }
 
-func (s *Session) ScanRow(row *sql.Row) error {
+// ScanRow scans a single-row result such as *sql.Row.
+func (s *Session) ScanRow(row interface{ Scan(dest ...any) error }) error {
 	return row.Scan(
 		&s.ID,
 		&s.UserID,
 		&s.IPAddress,
 		&s.UserAgent,
+		&s.Browser,
+		&s.OS,
+		&s.DeviceType,
+		&s.Country,
+		&s.City,
 		&s.CreatedAt,
 		&s.UpdatedAt,
 	)
-}
\ No newline at end of file
+}
@@ -19,6 +19,9 @@ type User struct {
 	Role           UserRole  `json:"role"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+	// TokenGeneration is embedded in the JWTs issued to the user; raising
+	// it revokes all of them
+	TokenGeneration int64 `json:"-"`
 }
 
 type UserCreateParams struct {
@@ -60,6 +63,7 @@ func (u *User) Scan(rows *sql.Rows) error {
 		&u.Role,
 		&u.CreatedAt,
 		&u.UpdatedAt,
+		&u.TokenGeneration,
 	)
 }
 
@@ -71,5 +75,6 @@ func (u *User) ScanRow(row *sql.Row) error {
 		&u.Role,
 		&u.CreatedAt,
 		&u.UpdatedAt,
+		&u.TokenGeneration,
 	)
-}
\ No newline at end of file
+}
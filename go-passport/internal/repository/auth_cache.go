@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/cache"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/models"
+)
+
+// AuthCache holds the users and sessions looked up on every authenticated
+// request. Repositories read through it and invalidate it on writes. Values
+// are stored by value so callers can't mutate cached entries.
+type AuthCache struct {
+	users    *cache.Cache[int64, models.User]
+	sessions *cache.Cache[int64, models.Session]
+}
+
+// NewAuthCache creates a cache holding up to maxEntries users and as many
+// sessions. A ttl <= 0 disables caching.
+func NewAuthCache(maxEntries int, ttl time.Duration) *AuthCache {
+	if ttl <= 0 {
+		return &AuthCache{}
+	}
+
+	return &AuthCache{
+		users:    cache.New[int64, models.User](maxEntries, ttl),
+		sessions: cache.New[int64, models.Session](maxEntries, ttl),
+	}
+}
+
+// Enabled reports whether caching is turned on.
+func (c *AuthCache) Enabled() bool {
+	return c != nil && c.users != nil
+}
+
+// loadUser returns the cached user or calls load and caches its result.
+// Inside a transaction it always loads, since the transaction may see
+// uncommitted changes.
+func (c *AuthCache) loadUser(ctx context.Context, id int64, load func(ctx context.Context) (*models.User, error)) (*models.User, error) {
+	if c == nil || config.InTransaction(ctx) {
+		return load(ctx)
+	}
+
+	user, err := c.users.GetOrLoad(ctx, id, func(ctx context.Context) (models.User, error) {
+		user, err := load(ctx)
+		if err != nil {
+			return models.User{}, err
+		}
+		return *user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// loadSession returns the cached session or calls load and caches its
+// result, except inside a transaction.
+func (c *AuthCache) loadSession(ctx context.Context, id int64, load func(ctx context.Context) (*models.Session, error)) (*models.Session, error) {
+	if c == nil || config.InTransaction(ctx) {
+		return load(ctx)
+	}
+
+	session, err := c.sessions.GetOrLoad(ctx, id, func(ctx context.Context) (models.Session, error) {
+		session, err := load(ctx)
+		if err != nil {
+			return models.Session{}, err
+		}
+		return *session, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (c *AuthCache) InvalidateUser(id int64) {
+	if c == nil {
+		return
+	}
+	c.users.Delete(id)
+}
+
+func (c *AuthCache) InvalidateSession(id int64) {
+	if c == nil {
+		return
+	}
+	c.sessions.Delete(id)
+}
+
+func (c *AuthCache) InvalidateUserSessions(userID int64) {
+	if c == nil {
+		return
+	}
+	c.sessions.DeleteFunc(func(_ int64, session models.Session) bool {
+		return session.UserID == userID
+	})
+}
+
+func (c *AuthCache) InvalidateSessionsBefore(cutoff time.Time) {
+	if c == nil {
+		return
+	}
+	c.sessions.DeleteFunc(func(_ int64, session models.Session) bool {
+		return session.CreatedAt.Before(cutoff)
+	})
+}
+
+func (c *AuthCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.users.Purge()
+	c.sessions.Purge()
+}
+
+func (c *AuthCache) UserStats() cache.Stats {
+	if c == nil {
+		return cache.Stats{}
+	}
+	return c.users.Stats()
+}
+
+func (c *AuthCache) SessionStats() cache.Stats {
+	if c == nil {
+		return cache.Stats{}
+	}
+	return c.sessions.Stats()
+}
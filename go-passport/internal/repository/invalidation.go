@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/oceanheart/go-passport/internal/config"
+)
+
+// InvalidationChannel is the Postgres NOTIFY channel used to tell every
+// instance to evict cached users and sessions.
+const InvalidationChannel = "passport_cache_invalidation"
+
+const (
+	invalidateUser         = "user"
+	invalidateSession      = "session"
+	invalidateUserSessions = "user_sessions"
+	invalidateSessionsTill = "sessions_before"
+)
+
+type invalidationEvent struct {
+	Type   string     `json:"type"`
+	ID     int64      `json:"id,omitempty"`
+	Before *time.Time `json:"before,omitempty"`
+}
+
+// invalidate evicts entries from the local cache and notifies other
+// instances to do the same. The write it describes has already succeeded, so
+// publish failures are logged rather than returned; peers fall back to the
+// cache TTL. Other instances may cache even when this one doesn't, so
+// events are published regardless. SQLite has no NOTIFY, so there only the
+// local cache is updated. Inside a transaction this waits for the commit, so
+// that concurrent reads can't cache the old rows again in between.
+func invalidate(ctx context.Context, db *config.Database, cache *AuthCache, logger *slog.Logger, events ...invalidationEvent) {
+	config.AfterCommit(ctx, func() {
+		publish(ctx, db, cache, logger, events)
+	})
+}
+
+func publish(ctx context.Context, db *config.Database, cache *AuthCache, logger *slog.Logger, events []invalidationEvent) {
+	for _, event := range events {
+		if cache.Enabled() {
+			cache.apply(event)
+		}
+		if db.Dialect != config.Postgres {
+			continue
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to encode cache invalidation", "error", err)
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, "SELECT pg_notify($1, $2)", InvalidationChannel, string(payload)); err != nil {
+			logger.ErrorContext(ctx, "failed to publish cache invalidation", "event", string(payload), "error", err)
+		}
+	}
+}
+
+func userEvent(id int64) invalidationEvent {
+	return invalidationEvent{Type: invalidateUser, ID: id}
+}
+
+func sessionEvent(id int64) invalidationEvent {
+	return invalidationEvent{Type: invalidateSession, ID: id}
+}
+
+func userSessionsEvent(userID int64) invalidationEvent {
+	return invalidationEvent{Type: invalidateUserSessions, ID: userID}
+}
+
+func sessionsBeforeEvent(cutoff time.Time) invalidationEvent {
+	return invalidationEvent{Type: invalidateSessionsTill, Before: &cutoff}
+}
+
+func (c *AuthCache) apply(event invalidationEvent) {
+	switch event.Type {
+	case invalidateUser:
+		c.InvalidateUser(event.ID)
+	case invalidateSession:
+		c.InvalidateSession(event.ID)
+	case invalidateUserSessions:
+		c.InvalidateUserSessions(event.ID)
+	case invalidateSessionsTill:
+		if event.Before == nil {
+			c.Purge()
+			return
+		}
+		c.InvalidateSessionsBefore(*event.Before)
+	default:
+		// Unknown event from a newer version; be safe and drop everything.
+		c.Purge()
+	}
+}
+
+// InvalidationListener keeps a dedicated connection LISTENing for cache
+// invalidations published by any instance and evicts the affected entries
+// from the local AuthCache.
+type InvalidationListener struct {
+	databaseURL string
+	cache       *AuthCache
+	logger      *slog.Logger
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	connected   atomic.Bool
+}
+
+func NewInvalidationListener(databaseURL string, cache *AuthCache, logger *slog.Logger) *InvalidationListener {
+	return &InvalidationListener{
+		databaseURL: databaseURL,
+		cache:       cache,
+		logger:      logger,
+		minBackoff:  500 * time.Millisecond,
+		maxBackoff:  30 * time.Second,
+	}
+}
+
+// Connected reports whether the listener currently holds a live connection.
+func (l *InvalidationListener) Connected() bool {
+	return l.connected.Load()
+}
+
+// Run listens until ctx is cancelled, reconnecting with exponential backoff
+// whenever the connection drops.
+func (l *InvalidationListener) Run(ctx context.Context) {
+	backoff := l.minBackoff
+
+	for {
+		err := l.listen(ctx, func() { backoff = l.minBackoff })
+		l.connected.Store(false)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		l.logger.Warn("cache invalidation listener disconnected", "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > l.maxBackoff {
+			backoff = l.maxBackoff
+		}
+	}
+}
+
+func (l *InvalidationListener) listen(ctx context.Context, onConnect func()) error {
+	conn, err := pgx.Connect(ctx, l.databaseURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{InvalidationChannel}.Sanitize()); err != nil {
+		return err
+	}
+
+	// Anything published while we were disconnected was missed.
+	l.cache.Purge()
+	l.connected.Store(true)
+	onConnect()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event invalidationEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			l.logger.Warn("ignoring malformed cache invalidation", "payload", notification.Payload, "error", err)
+			continue
+		}
+
+		l.cache.apply(event)
+	}
+}
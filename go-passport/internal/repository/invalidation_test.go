@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/oceanheart/go-passport/db/migrations"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/models"
+)
+
+// An instance with its cache disabled must still tell the others to evict.
+func TestInvalidationPublishedWithoutCache(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db, err := config.NewDatabase(&config.Config{DatabaseURL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := config.NewMigrator(db, migrations.FS, logger).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `TRUNCATE users, sessions RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{InvalidationChannel}.Sanitize()); err != nil {
+		t.Fatal(err)
+	}
+
+	users := NewUserRepository(db, NewAuthCache(100, 0), logger)
+	user := &models.User{EmailAddress: "alice@example.com", PasswordDigest: "digest"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.UpdateRole(ctx, user.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	notification, err := conn.WaitForNotification(ctx)
+	if err != nil {
+		t.Fatalf("no invalidation published: %v", err)
+	}
+	var event invalidationEvent
+	if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil || event != userEvent(user.ID) {
+		t.Fatalf("published %q, want a user event for %d", notification.Payload, user.ID)
+	}
+}
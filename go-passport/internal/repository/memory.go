@@ -0,0 +1,387 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/models"
+)
+
+// MemoryStore keeps users and sessions in memory, for tests and local
+// experiments. It behaves like the Postgres repositories, down to the
+// errors they return and deleting a user's sessions with the user.
+type MemoryStore struct {
+	mu            sync.Mutex
+	users         map[int64]*models.User
+	sessions      map[int64]*models.Session
+	nextUserID    int64
+	nextSessionID int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:    make(map[int64]*models.User),
+		sessions: make(map[int64]*models.Session),
+	}
+}
+
+// Users returns the store's users.
+func (s *MemoryStore) Users() UserStore {
+	return memoryUsers{s}
+}
+
+// Sessions returns the store's sessions.
+func (s *MemoryStore) Sessions() SessionStore {
+	return memorySessions{s}
+}
+
+// Transact runs fn and restores the store's previous contents if it fails.
+// Unlike a database transaction it doesn't isolate fn from concurrent
+// writes, which a rollback undoes as well.
+func (s *MemoryStore) Transact(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.mu.Lock()
+	users, sessions := clonePointers(s.users), clonePointers(s.sessions)
+	nextUserID, nextSessionID := s.nextUserID, s.nextSessionID
+	s.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		s.mu.Lock()
+		s.users, s.sessions = users, sessions
+		s.nextUserID, s.nextSessionID = nextUserID, nextSessionID
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+type memoryUsers struct {
+	s *MemoryStore
+}
+
+func (r memoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.userByEmail(user.EmailAddress) != nil {
+		return ErrUserAlreadyExists
+	}
+
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+
+	r.s.nextUserID++
+	user.ID = r.s.nextUserID
+
+	stored := *user
+	stored.EmailAddress = strings.ToLower(user.EmailAddress)
+	r.s.users[user.ID] = &stored
+
+	return nil
+}
+
+func (r memoryUsers) FindByID(ctx context.Context, id int64) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (r memoryUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user := r.s.userByEmail(email)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (r memoryUsers) Update(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.users[user.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if other := r.s.userByEmail(user.EmailAddress); other != nil && other.ID != user.ID {
+		return ErrUserAlreadyExists
+	}
+
+	user.UpdatedAt = time.Now()
+
+	stored.EmailAddress = strings.ToLower(user.EmailAddress)
+	stored.PasswordDigest = user.PasswordDigest
+	stored.Role = user.Role
+	stored.TokenGeneration = user.TokenGeneration
+	stored.UpdatedAt = user.UpdatedAt
+
+	return nil
+}
+
+func (r memoryUsers) UpdateRole(ctx context.Context, id int64, role models.UserRole) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (r memoryUsers) Delete(ctx context.Context, id int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(r.s.users, id)
+
+	// Like ON DELETE CASCADE
+	for sessionID, session := range r.s.sessions {
+		if session.UserID == id {
+			delete(r.s.sessions, sessionID)
+		}
+	}
+
+	return nil
+}
+
+func (r memoryUsers) List(ctx context.Context, offset, limit int) ([]*models.User, error) {
+	return r.s.listUsers(func(*models.User) bool { return true }, offset, limit), nil
+}
+
+func (r memoryUsers) Count(ctx context.Context) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return int64(len(r.s.users)), nil
+}
+
+func (r memoryUsers) ListByRole(ctx context.Context, role models.UserRole) ([]*models.User, error) {
+	users := r.s.listUsers(func(user *models.User) bool { return user.Role == role }, 0, -1)
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r memoryUsers) Search(ctx context.Context, searchTerm string, offset, limit int) ([]*models.User, error) {
+	searchTerm = strings.ToLower(searchTerm)
+	return r.s.listUsers(func(user *models.User) bool {
+		return strings.Contains(user.EmailAddress, searchTerm)
+	}, offset, limit), nil
+}
+
+// userByEmail finds a user by email address, ignoring case. The caller
+// holds s.mu.
+func (s *MemoryStore) userByEmail(email string) *models.User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.EmailAddress, email) {
+			return user
+		}
+	}
+	return nil
+}
+
+// listUsers returns copies of the users matching match, newest first. A
+// negative limit returns all of them.
+func (s *MemoryStore) listUsers(match func(*models.User) bool, offset, limit int) []*models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []*models.User
+	for _, user := range s.users {
+		if match(user) {
+			users = append(users, copyUser(user))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.After(users[j].CreatedAt)
+		}
+		return users[i].ID > users[j].ID
+	})
+
+	return page(users, offset, limit)
+}
+
+type memorySessions struct {
+	s *MemoryStore
+}
+
+func (r memorySessions) Create(ctx context.Context, session *models.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Like the foreign key on sessions.user_id
+	if _, ok := r.s.users[session.UserID]; !ok {
+		return fmt.Errorf("failed to create session: %w", ErrUserNotFound)
+	}
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.UpdatedAt = now
+
+	r.s.nextSessionID++
+	session.ID = r.s.nextSessionID
+
+	stored := *session
+	r.s.sessions[session.ID] = &stored
+
+	return nil
+}
+
+func (r memorySessions) FindByID(ctx context.Context, id int64) (*models.Session, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return copySession(session), nil
+}
+
+func (r memorySessions) FindByUserID(ctx context.Context, userID int64) ([]*models.Session, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var sessions []*models.Session
+	for _, session := range r.s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, copySession(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+
+	return sessions, nil
+}
+
+func (r memorySessions) Update(ctx context.Context, session *models.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.sessions[session.ID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	session.UpdatedAt = time.Now()
+
+	stored.IPAddress = session.IPAddress
+	stored.UserAgent = session.UserAgent
+	stored.Browser = session.Browser
+	stored.OS = session.OS
+	stored.DeviceType = session.DeviceType
+	stored.Country = session.Country
+	stored.City = session.City
+	stored.UpdatedAt = session.UpdatedAt
+
+	return nil
+}
+
+func (r memorySessions) Delete(ctx context.Context, id int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(r.s.sessions, id)
+
+	return nil
+}
+
+func (r memorySessions) DeleteByUserID(ctx context.Context, userID int64) error {
+	r.deleteWhere(func(session *models.Session) bool { return session.UserID == userID })
+	return nil
+}
+
+func (r memorySessions) DeleteExpired(ctx context.Context, expiryDuration time.Duration) (int64, error) {
+	expiryTime := time.Now().Add(-expiryDuration)
+	return r.deleteWhere(func(session *models.Session) bool { return session.CreatedAt.Before(expiryTime) }), nil
+}
+
+func (r memorySessions) CountByUserID(ctx context.Context, userID int64) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var count int64
+	for _, session := range r.s.sessions {
+		if session.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r memorySessions) deleteWhere(match func(*models.Session) bool) int64 {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var deleted int64
+	for id, session := range r.s.sessions {
+		if match(session) {
+			delete(r.s.sessions, id)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func copyUser(user *models.User) *models.User {
+	c := *user
+	return &c
+}
+
+func copySession(session *models.Session) *models.Session {
+	c := *session
+	return &c
+}
+
+// page applies offset and limit to items like SQL does. A negative limit
+// means no limit.
+func page[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// clonePointers copies m along with the values it points to.
+func clonePointers[T any](m map[int64]*T) map[int64]*T {
+	clone := make(map[int64]*T, len(m))
+	for k, v := range m {
+		copied := *v
+		clone[k] = &copied
+	}
+	return clone
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/oceanheart/go-passport/internal/config"
@@ -16,17 +17,19 @@ var (
 )
 
 type SessionRepository struct {
-	db *config.Database
+	db     *config.Database
+	cache  *AuthCache
+	logger *slog.Logger
 }
 
-func NewSessionRepository(db *config.Database) *SessionRepository {
-	return &SessionRepository{db: db}
+func NewSessionRepository(db *config.Database, cache *AuthCache, logger *slog.Logger) *SessionRepository {
+	return &SessionRepository{db: db, cache: cache, logger: logger}
 }
 
 func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
 	query := `
-		INSERT INTO sessions (user_id, ip_address, user_agent, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO sessions (user_id, ip_address, user_agent, browser, os, device_type, country, city, created_at, updated_at)
+		VALUES ($1, ` + r.ipParam(2) + `, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id`
 	
 	now := time.Now()
@@ -39,11 +42,19 @@ func (r *SessionRepository) Create(ctx context.Context, session *models.Session)
 		session.UserID,
 		session.IPAddress,
 		session.UserAgent,
+		session.Browser,
+		session.OS,
+		session.DeviceType,
+		session.Country,
+		session.City,
 		session.CreatedAt,
 		session.UpdatedAt,
 	).Scan(&session.ID)
 	
 	if err != nil {
+		if errors.Is(err, config.ErrForeignKeyViolation) {
+			return fmt.Errorf("failed to create session: %w (%w)", ErrUserNotFound, err)
+		}
 		return fmt.Errorf("failed to create session: %w", err)
 	}
 	
@@ -51,20 +62,19 @@ func (r *SessionRepository) Create(ctx context.Context, session *models.Session)
 }
 
 func (r *SessionRepository) FindByID(ctx context.Context, id int64) (*models.Session, error) {
+	return r.cache.loadSession(ctx, id, func(ctx context.Context) (*models.Session, error) {
+		return r.findByID(ctx, id)
+	})
+}
+
+func (r *SessionRepository) findByID(ctx context.Context, id int64) (*models.Session, error) {
 	query := `
-		SELECT id, user_id, ip_address, user_agent, created_at, updated_at
+		SELECT ` + r.columns() + `
 		FROM sessions
 		WHERE id = $1`
 	
 	session := &models.Session{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&session.ID,
-		&session.UserID,
-		&session.IPAddress,
-		&session.UserAgent,
-		&session.CreatedAt,
-		&session.UpdatedAt,
-	)
+	err := session.ScanRow(r.db.QueryRowContext(ctx, query, id))
 	
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -78,7 +88,7 @@ func (r *SessionRepository) FindByID(ctx context.Context, id int64) (*models.Ses
 
 func (r *SessionRepository) FindByUserID(ctx context.Context, userID int64) ([]*models.Session, error) {
 	query := `
-		SELECT id, user_id, ip_address, user_agent, created_at, updated_at
+		SELECT ` + r.columns() + `
 		FROM sessions
 		WHERE user_id = $1
 		ORDER BY created_at DESC`
@@ -122,6 +132,8 @@ func (r *SessionRepository) Delete(ctx context.Context, id int64) error {
 		return ErrSessionNotFound
 	}
 	
+	invalidate(ctx, r.db, r.cache, r.logger, sessionEvent(id))
+	
 	return nil
 }
 
@@ -133,26 +145,38 @@ func (r *SessionRepository) DeleteByUserID(ctx context.Context, userID int64) er
 		return fmt.Errorf("failed to delete sessions by user ID: %w", err)
 	}
 	
+	invalidate(ctx, r.db, r.cache, r.logger, userSessionsEvent(userID))
+	
 	return nil
 }
 
-func (r *SessionRepository) DeleteExpired(ctx context.Context, expiryDuration time.Duration) error {
+// DeleteExpired deletes sessions created more than expiryDuration ago and
+// returns how many were deleted.
+func (r *SessionRepository) DeleteExpired(ctx context.Context, expiryDuration time.Duration) (int64, error) {
 	query := `DELETE FROM sessions WHERE created_at < $1`
 	
 	expiryTime := time.Now().Add(-expiryDuration)
-	_, err := r.db.ExecContext(ctx, query, expiryTime)
+	result, err := r.db.ExecContext(ctx, query, expiryTime)
 	if err != nil {
-		return fmt.Errorf("failed to delete expired sessions: %w", err)
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
 	}
 	
-	return nil
+	invalidate(ctx, r.db, r.cache, r.logger, sessionsBeforeEvent(expiryTime))
+	
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	
+	return deleted, nil
 }
 
 func (r *SessionRepository) Update(ctx context.Context, session *models.Session) error {
 	query := `
 		UPDATE sessions
-		SET ip_address = $1, user_agent = $2, updated_at = $3
-		WHERE id = $4`
+		SET ip_address = ` + r.ipParam(1) + `, user_agent = $2, browser = $3, os = $4, device_type = $5,
+			country = $6, city = $7, updated_at = $8
+		WHERE id = $9`
 	
 	session.UpdatedAt = time.Now()
 	
@@ -161,6 +185,11 @@ func (r *SessionRepository) Update(ctx context.Context, session *models.Session)
 		query,
 		session.IPAddress,
 		session.UserAgent,
+		session.Browser,
+		session.OS,
+		session.DeviceType,
+		session.Country,
+		session.City,
 		session.UpdatedAt,
 		session.ID,
 	)
@@ -178,6 +207,8 @@ func (r *SessionRepository) Update(ctx context.Context, session *models.Session)
 		return ErrSessionNotFound
 	}
 	
+	invalidate(ctx, r.db, r.cache, r.logger, sessionEvent(session.ID))
+	
 	return nil
 }
 
@@ -191,4 +222,24 @@ func (r *SessionRepository) CountByUserID(ctx context.Context, userID int64) (in
 	}
 	
 	return count, nil
-}
\ No newline at end of file
+}
+
+// columns lists the columns models.Session scans. Postgres stores the IP
+// address as inet, SQLite as text.
+func (r *SessionRepository) columns() string {
+	ip := "COALESCE(host(ip_address), '')"
+	if r.db.Dialect == config.SQLite {
+		ip = "COALESCE(ip_address, '')"
+	}
+	return "id, user_id, " + ip + ", user_agent, browser, os, device_type, country, city, created_at, updated_at"
+}
+
+// ipParam is the nth query parameter as an IP address; an empty string is
+// stored as NULL.
+func (r *SessionRepository) ipParam(n int) string {
+	param := fmt.Sprintf("NULLIF($%d, '')", n)
+	if r.db.Dialect == config.SQLite {
+		return param
+	}
+	return param + "::inet"
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/models"
+)
+
+// UserStore persists users. Implementations return ErrUserNotFound and
+// ErrUserAlreadyExists, treat email addresses case-insensitively and store
+// them lower-cased.
+type UserStore interface {
+	Create(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, id int64) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	Update(ctx context.Context, user *models.User) error
+	UpdateRole(ctx context.Context, id int64, role models.UserRole) error
+	// Delete also deletes the user's sessions.
+	Delete(ctx context.Context, id int64) error
+	// List and Search return users newest first.
+	List(ctx context.Context, offset, limit int) ([]*models.User, error)
+	Count(ctx context.Context) (int64, error)
+	ListByRole(ctx context.Context, role models.UserRole) ([]*models.User, error)
+	Search(ctx context.Context, searchTerm string, offset, limit int) ([]*models.User, error)
+}
+
+// SessionStore persists sessions. Implementations return ErrSessionNotFound
+// and refuse sessions for users that don't exist.
+type SessionStore interface {
+	Create(ctx context.Context, session *models.Session) error
+	FindByID(ctx context.Context, id int64) (*models.Session, error)
+	// FindByUserID returns the user's sessions newest first.
+	FindByUserID(ctx context.Context, userID int64) ([]*models.Session, error)
+	Update(ctx context.Context, session *models.Session) error
+	Delete(ctx context.Context, id int64) error
+	DeleteByUserID(ctx context.Context, userID int64) error
+	// DeleteExpired deletes sessions created more than expiryDuration ago
+	// and returns how many were deleted.
+	DeleteExpired(ctx context.Context, expiryDuration time.Duration) (int64, error)
+	CountByUserID(ctx context.Context, userID int64) (int64, error)
+}
+
+// Transactor runs fn atomically: stores called with the context fn is given
+// either apply all of fn's writes or, if fn returns an error, none of them.
+// fn may run more than once.
+type Transactor interface {
+	Transact(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+var (
+	_ UserStore    = (*UserRepository)(nil)
+	_ SessionStore = (*SessionRepository)(nil)
+	_ Transactor   = (*config.Database)(nil)
+	_ Transactor   = (*MemoryStore)(nil)
+)
@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/oceanheart/go-passport/db/migrations"
+	"github.com/oceanheart/go-passport/internal/config"
+	"github.com/oceanheart/go-passport/internal/models"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStores(t, func(t *testing.T) (UserStore, SessionStore) {
+		store := NewMemoryStore()
+		return store.Users(), store.Sessions()
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	testStores(t, func(t *testing.T) (UserStore, SessionStore) {
+		db, err := config.NewDatabase(&config.Config{DatabaseURL: "sqlite:" + filepath.Join(t.TempDir(), "passport.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := config.NewMigrator(db, migrations.SQLite, logger).Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		cache := NewAuthCache(100, time.Minute)
+		return NewUserRepository(db, cache, logger), NewSessionRepository(db, cache, logger)
+	})
+}
+
+// TestPostgresStore runs against the database in TEST_DATABASE_URL, which it
+// migrates and empties. Use a database of its own.
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := config.NewDatabase(&config.Config{DatabaseURL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := config.NewMigrator(db, migrations.FS, logger).Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	testStores(t, func(t *testing.T) (UserStore, SessionStore) {
+		if _, err := db.ExecContext(context.Background(), `TRUNCATE users, sessions RESTART IDENTITY CASCADE`); err != nil {
+			t.Fatal(err)
+		}
+		cache := NewAuthCache(100, time.Minute)
+		return NewUserRepository(db, cache, logger), NewSessionRepository(db, cache, logger)
+	})
+}
+
+// testStores checks the behavior every UserStore and SessionStore shares.
+// newStores returns empty stores.
+func testStores(t *testing.T, newStores func(t *testing.T) (UserStore, SessionStore)) {
+	ctx := context.Background()
+
+	createUser := func(t *testing.T, users UserStore, email string) *models.User {
+		t.Helper()
+		user := &models.User{EmailAddress: email, PasswordDigest: "digest"}
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatalf("Create(%q) error = %v", email, err)
+		}
+		return user
+	}
+
+	t.Run("users", func(t *testing.T) {
+		users, _ := newStores(t)
+
+		user := createUser(t, users, "Alice@Example.com")
+		if user.ID == 0 || user.Role != models.RoleUser || user.CreatedAt.IsZero() {
+			t.Fatalf("Create() = %+v", user)
+		}
+		if err := users.Create(ctx, &models.User{EmailAddress: "alice@EXAMPLE.com", PasswordDigest: "digest"}); !errors.Is(err, ErrUserAlreadyExists) {
+			t.Fatalf("Create(duplicate) error = %v, want ErrUserAlreadyExists", err)
+		}
+
+		found, err := users.FindByEmail(ctx, "ALICE@example.com")
+		if err != nil || found.ID != user.ID || found.EmailAddress != "alice@example.com" {
+			t.Fatalf("FindByEmail() = %+v, %v", found, err)
+		}
+		if _, err := users.FindByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("FindByEmail(unknown) error = %v, want ErrUserNotFound", err)
+		}
+		if _, err := users.FindByID(ctx, user.ID+1000); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("FindByID(unknown) error = %v, want ErrUserNotFound", err)
+		}
+
+		found.EmailAddress = "Alice2@example.com"
+		found.PasswordDigest = "new digest"
+		if err := users.Update(ctx, found); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.UpdateRole(ctx, user.ID, models.RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+		found, err = users.FindByID(ctx, user.ID)
+		if err != nil || found.EmailAddress != "alice2@example.com" || found.PasswordDigest != "new digest" || found.Role != models.RoleAdmin {
+			t.Fatalf("FindByID() after updates = %+v, %v", found, err)
+		}
+
+		bob := createUser(t, users, "bob@example.com")
+		bob.EmailAddress = "ALICE2@example.com"
+		if err := users.Update(ctx, bob); !errors.Is(err, ErrUserAlreadyExists) {
+			t.Fatalf("Update(taken email) error = %v, want ErrUserAlreadyExists", err)
+		}
+		if err := users.Update(ctx, &models.User{ID: user.ID + 1000, EmailAddress: "x@example.com", Role: models.RoleUser}); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("Update(unknown) error = %v, want ErrUserNotFound", err)
+		}
+		if err := users.UpdateRole(ctx, user.ID+1000, models.RoleAdmin); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("UpdateRole(unknown) error = %v, want ErrUserNotFound", err)
+		}
+
+		if err := users.Delete(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.FindByID(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("FindByID(deleted) error = %v, want ErrUserNotFound", err)
+		}
+		if err := users.Delete(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("Delete(deleted) error = %v, want ErrUserNotFound", err)
+		}
+	})
+
+	t.Run("list and search", func(t *testing.T) {
+		users, _ := newStores(t)
+
+		for _, email := range []string{"a@example.com", "b@example.com", "c@example.org", "d@example.org"} {
+			createUser(t, users, email)
+		}
+		admin := createUser(t, users, "admin@example.net")
+		if err := users.UpdateRole(ctx, admin.ID, models.RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := users.Count(ctx)
+		if err != nil || count != 5 {
+			t.Fatalf("Count() = %d, %v, want 5", count, err)
+		}
+
+		all, err := users.List(ctx, 0, 10)
+		if err != nil || len(all) != 5 {
+			t.Fatalf("List() = %d users, %v, want 5", len(all), err)
+		}
+		if !sort.SliceIsSorted(all, func(i, j int) bool { return all[i].CreatedAt.After(all[j].CreatedAt) }) {
+			t.Error("List() isn't newest first")
+		}
+		page, err := users.List(ctx, 4, 10)
+		if err != nil || len(page) != 1 {
+			t.Fatalf("List(offset 4) = %d users, %v, want 1", len(page), err)
+		}
+		if page, err := users.List(ctx, 1, 2); err != nil || len(page) != 2 {
+			t.Fatalf("List(limit 2) = %d users, %v, want 2", len(page), err)
+		}
+
+		found, err := users.Search(ctx, "EXAMPLE.ORG", 0, 10)
+		if err != nil || len(found) != 2 {
+			t.Fatalf("Search() = %d users, %v, want 2", len(found), err)
+		}
+
+		admins, err := users.ListByRole(ctx, models.RoleAdmin)
+		if err != nil || len(admins) != 1 || admins[0].ID != admin.ID {
+			t.Fatalf("ListByRole(admin) = %v, %v", admins, err)
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		users, sessions := newStores(t)
+		user := createUser(t, users, "alice@example.com")
+		other := createUser(t, users, "bob@example.com")
+
+		if err := sessions.Create(ctx, &models.Session{UserID: user.ID + 1000}); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("Create() for an unknown user error = %v, want ErrUserNotFound", err)
+		}
+
+		session := &models.Session{UserID: user.ID, IPAddress: "203.0.113.5", UserAgent: "curl/8.0", Browser: "curl"}
+		if err := sessions.Create(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+		second := &models.Session{UserID: user.ID, IPAddress: "203.0.113.6"}
+		if err := sessions.Create(ctx, second); err != nil {
+			t.Fatal(err)
+		}
+		if err := sessions.Create(ctx, &models.Session{UserID: other.ID}); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := sessions.FindByID(ctx, session.ID)
+		if err != nil || found.UserID != user.ID || found.IPAddress != "203.0.113.5" || found.Browser != "curl" {
+			t.Fatalf("FindByID() = %+v, %v", found, err)
+		}
+		if _, err := sessions.FindByID(ctx, second.ID+1000); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("FindByID(unknown) error = %v, want ErrSessionNotFound", err)
+		}
+
+		found.City = "Berlin"
+		if err := sessions.Update(ctx, found); err != nil {
+			t.Fatal(err)
+		}
+		if found, err := sessions.FindByID(ctx, session.ID); err != nil || found.City != "Berlin" {
+			t.Fatalf("FindByID() after Update = %+v, %v", found, err)
+		}
+		if err := sessions.Update(ctx, &models.Session{ID: second.ID + 1000}); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("Update(unknown) error = %v, want ErrSessionNotFound", err)
+		}
+
+		list, err := sessions.FindByUserID(ctx, user.ID)
+		if err != nil || len(list) != 2 || list[0].ID != second.ID {
+			t.Fatalf("FindByUserID() = %v, %v, want newest first", list, err)
+		}
+		if count, err := sessions.CountByUserID(ctx, user.ID); err != nil || count != 2 {
+			t.Fatalf("CountByUserID() = %d, %v, want 2", count, err)
+		}
+
+		if err := sessions.Delete(ctx, second.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := sessions.Delete(ctx, second.ID); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("Delete(deleted) error = %v, want ErrSessionNotFound", err)
+		}
+		if err := sessions.DeleteByUserID(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sessions.FindByID(ctx, session.ID); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("FindByID() after DeleteByUserID error = %v, want ErrSessionNotFound", err)
+		}
+
+		if deleted, err := sessions.DeleteExpired(ctx, time.Hour); err != nil || deleted != 0 {
+			t.Fatalf("DeleteExpired(1h) = %d, %v, want 0", deleted, err)
+		}
+		if deleted, err := sessions.DeleteExpired(ctx, 0); err != nil || deleted != 1 {
+			t.Fatalf("DeleteExpired(0) = %d, %v, want 1", deleted, err)
+		}
+	})
+
+	t.Run("deleting a user deletes their sessions", func(t *testing.T) {
+		users, sessions := newStores(t)
+		user := createUser(t, users, "alice@example.com")
+
+		session := &models.Session{UserID: user.ID}
+		if err := sessions.Create(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Delete(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sessions.FindByID(ctx, session.ID); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("FindByID() error = %v, want ErrSessionNotFound", err)
+		}
+	})
+}
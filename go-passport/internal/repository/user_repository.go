@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -18,11 +19,13 @@ var (
 )
 
 type UserRepository struct {
-	db *config.Database
+	db     *config.Database
+	cache  *AuthCache
+	logger *slog.Logger
 }
 
-func NewUserRepository(db *config.Database) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *config.Database, cache *AuthCache, logger *slog.Logger) *UserRepository {
+	return &UserRepository{db: db, cache: cache, logger: logger}
 }
 
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
@@ -50,8 +53,8 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	).Scan(&user.ID)
 	
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") {
-			return ErrUserAlreadyExists
+		if errors.Is(err, config.ErrUniqueViolation) {
+			return fmt.Errorf("%w (%w)", ErrUserAlreadyExists, err)
 		}
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -60,8 +63,14 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 }
 
 func (r *UserRepository) FindByID(ctx context.Context, id int64) (*models.User, error) {
+	return r.cache.loadUser(ctx, id, func(ctx context.Context) (*models.User, error) {
+		return r.findByID(ctx, id)
+	})
+}
+
+func (r *UserRepository) findByID(ctx context.Context, id int64) (*models.User, error) {
 	query := `
-		SELECT id, email_address, password_digest, role, created_at, updated_at
+		SELECT id, email_address, password_digest, role, created_at, updated_at, token_generation
 		FROM users
 		WHERE id = $1`
 	
@@ -73,6 +82,7 @@ func (r *UserRepository) FindByID(ctx context.Context, id int64) (*models.User,
 		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.TokenGeneration,
 	)
 	
 	if err != nil {
@@ -87,7 +97,7 @@ func (r *UserRepository) FindByID(ctx context.Context, id int64) (*models.User,
 
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, email_address, password_digest, role, created_at, updated_at
+		SELECT id, email_address, password_digest, role, created_at, updated_at, token_generation
 		FROM users
 		WHERE LOWER(email_address) = LOWER($1)`
 	
@@ -99,6 +109,7 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models
 		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.TokenGeneration,
 	)
 	
 	if err != nil {
@@ -114,8 +125,8 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET email_address = $1, password_digest = $2, role = $3, updated_at = $4
-		WHERE id = $5`
+		SET email_address = $1, password_digest = $2, role = $3, updated_at = $4, token_generation = $5
+		WHERE id = $6`
 	
 	user.UpdatedAt = time.Now()
 	
@@ -126,12 +137,13 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 		user.PasswordDigest,
 		user.Role,
 		user.UpdatedAt,
+		user.TokenGeneration,
 		user.ID,
 	)
 	
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") {
-			return ErrUserAlreadyExists
+		if errors.Is(err, config.ErrUniqueViolation) {
+			return fmt.Errorf("%w (%w)", ErrUserAlreadyExists, err)
 		}
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -145,6 +157,8 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 		return ErrUserNotFound
 	}
 	
+	invalidate(ctx, r.db, r.cache, r.logger, userEvent(user.ID))
+	
 	return nil
 }
 
@@ -168,6 +182,8 @@ func (r *UserRepository) UpdateRole(ctx context.Context, id int64, role models.U
 		return ErrUserNotFound
 	}
 	
+	invalidate(ctx, r.db, r.cache, r.logger, userEvent(id))
+	
 	return nil
 }
 
@@ -188,12 +204,15 @@ func (r *UserRepository) Delete(ctx context.Context, id int64) error {
 		return ErrUserNotFound
 	}
 	
+	// Sessions are removed by ON DELETE CASCADE
+	invalidate(ctx, r.db, r.cache, r.logger, userEvent(id), userSessionsEvent(id))
+	
 	return nil
 }
 
 func (r *UserRepository) List(ctx context.Context, offset, limit int) ([]*models.User, error) {
 	query := `
-		SELECT id, email_address, password_digest, role, created_at, updated_at
+		SELECT id, email_address, password_digest, role, created_at, updated_at, token_generation
 		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2`
@@ -232,9 +251,39 @@ func (r *UserRepository) Count(ctx context.Context) (int64, error) {
 	return count, nil
 }
 
+// ListByRole returns every user with the given role.
+func (r *UserRepository) ListByRole(ctx context.Context, role models.UserRole) ([]*models.User, error) {
+	query := `
+		SELECT id, email_address, password_digest, role, created_at, updated_at, token_generation
+		FROM users
+		WHERE role = $1
+		ORDER BY id`
+	
+	rows, err := r.db.QueryContext(ctx, query, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users by role: %w", err)
+	}
+	defer rows.Close()
+	
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		if err := user.Scan(rows); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	
+	return users, nil
+}
+
 func (r *UserRepository) Search(ctx context.Context, searchTerm string, offset, limit int) ([]*models.User, error) {
 	query := `
-		SELECT id, email_address, password_digest, role, created_at, updated_at
+		SELECT id, email_address, password_digest, role, created_at, updated_at, token_generation
 		FROM users
 		WHERE LOWER(email_address) LIKE LOWER($1)
 		ORDER BY created_at DESC
@@ -261,4 +310,4 @@ func (r *UserRepository) Search(ctx context.Context, searchTerm string, offset,
 	}
 	
 	return users, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oceanheart/go-passport/internal/models"
+	"github.com/oceanheart/go-passport/internal/repository"
+	"github.com/oceanheart/go-passport/internal/tracing"
+)
+
+// ErrNoAdmin is returned by RequireAdmin when no account is an admin.
+var ErrNoAdmin = errors.New("no admin account exists; create one with `passport user create EMAIL --admin`")
+
+// AdminBootstrap grants the admin role to the accounts listed in
+// ADMIN_EMAILS, on startup and reload for existing accounts and on sign-up
+// for new ones. With demote set, admins that aren't listed lose the role,
+// making the list the single source of truth.
+type AdminBootstrap struct {
+	userRepo repository.UserStore
+	policy   atomic.Pointer[adminPolicy]
+	logger   *slog.Logger
+}
+
+type adminPolicy struct {
+	emails map[string]bool
+	demote bool
+}
+
+func NewAdminBootstrap(userRepo repository.UserStore, emails []string, demote bool, logger *slog.Logger) *AdminBootstrap {
+	b := &AdminBootstrap{userRepo: userRepo, logger: logger}
+	b.SetPolicy(emails, demote)
+	return b
+}
+
+// SetPolicy replaces the admin list, e.g. on a configuration reload. Call
+// Sync afterwards to apply it to existing accounts.
+func (b *AdminBootstrap) SetPolicy(emails []string, demote bool) {
+	policy := &adminPolicy{emails: make(map[string]bool), demote: demote}
+	for _, email := range emails {
+		if email = normalizeEmail(email); email != "" {
+			policy.emails[email] = true
+		}
+	}
+	b.policy.Store(policy)
+}
+
+// RoleFor returns the role a new account with the given email starts with.
+func (b *AdminBootstrap) RoleFor(email string) models.UserRole {
+	if b != nil && b.policy.Load().emails[normalizeEmail(email)] {
+		return models.RoleAdmin
+	}
+	return models.RoleUser
+}
+
+// Sync promotes the existing accounts in the admin list and, if demotion is
+// enabled, demotes the other admins. Demotion is skipped while none of the
+// listed emails has an account, so it can't leave the service without an
+// admin.
+func (b *AdminBootstrap) Sync(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "AdminBootstrap.Sync")
+	defer span.End()
+
+	policy := b.policy.Load()
+	if len(policy.emails) == 0 {
+		if policy.demote {
+			b.logger.WarnContext(ctx, "ADMIN_DEMOTE_UNLISTED is set but ADMIN_EMAILS is empty; not demoting anyone")
+		}
+		return nil
+	}
+
+	listed := 0
+	for email := range policy.emails {
+		user, err := b.userRepo.FindByEmail(ctx, email)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+
+		listed++
+		if user.Role == models.RoleAdmin {
+			continue
+		}
+		if err := b.userRepo.UpdateRole(ctx, user.ID, models.RoleAdmin); err != nil {
+			return fmt.Errorf("failed to promote user: %w", err)
+		}
+		b.logger.InfoContext(ctx, "user promoted to admin from ADMIN_EMAILS", "target_user_id", user.ID)
+	}
+
+	if !policy.demote {
+		return nil
+	}
+	if listed == 0 {
+		b.logger.WarnContext(ctx, "no account in ADMIN_EMAILS exists yet; not demoting other admins")
+		return nil
+	}
+
+	admins, err := b.userRepo.ListByRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("failed to list admins: %w", err)
+	}
+	for _, user := range admins {
+		if policy.emails[normalizeEmail(user.EmailAddress)] {
+			continue
+		}
+		if err := b.userRepo.UpdateRole(ctx, user.ID, models.RoleUser); err != nil {
+			return fmt.Errorf("failed to demote user: %w", err)
+		}
+		b.logger.InfoContext(ctx, "admin not in ADMIN_EMAILS demoted", "target_user_id", user.ID)
+	}
+
+	return nil
+}
+
+// RequireAdmin returns ErrNoAdmin unless an admin account exists.
+func (b *AdminBootstrap) RequireAdmin(ctx context.Context) error {
+	admins, err := b.userRepo.ListByRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("failed to list admins: %w", err)
+	}
+	if len(admins) == 0 {
+		return ErrNoAdmin
+	}
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/oceanheart/go-passport/internal/models"
+	"github.com/oceanheart/go-passport/internal/repository"
+)
+
+func TestAdminBootstrap(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	b := NewAdminBootstrap(store.Users(), []string{" Admin@Oceanheart.ai ", ""}, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Listing an address that has no account yet doesn't satisfy
+	// RequireAdmin
+	if err := b.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RequireAdmin(ctx); !errors.Is(err, ErrNoAdmin) {
+		t.Fatalf("RequireAdmin() with no admin = %v, want ErrNoAdmin", err)
+	}
+
+	admin := &models.User{EmailAddress: "admin@oceanheart.ai", PasswordDigest: "digest"}
+	someone := &models.User{EmailAddress: "someone@oceanheart.ai", PasswordDigest: "digest"}
+	for _, user := range []*models.User{admin, someone} {
+		if err := store.Users().Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RequireAdmin(ctx); err != nil {
+		t.Fatalf("RequireAdmin() after Sync = %v", err)
+	}
+	role := func(id int64) models.UserRole {
+		user, err := store.Users().FindByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.Role
+	}
+	if role(admin.ID) != models.RoleAdmin || role(someone.ID) != models.RoleUser {
+		t.Fatal("Sync() didn't promote exactly the listed account")
+	}
+
+	b.SetPolicy([]string{"someone@oceanheart.ai"}, true)
+	if err := b.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if role(admin.ID) != models.RoleUser || role(someone.ID) != models.RoleAdmin {
+		t.Error("SetPolicy() with demote didn't replace the admins")
+	}
+}
+
+func TestAdminBootstrapRoleFor(t *testing.T) {
+	b := NewAdminBootstrap(nil, []string{" Admin@Oceanheart.ai ", ""}, false, slog.Default())
+
+	tests := map[string]models.UserRole{
+		"admin@oceanheart.ai":   models.RoleAdmin,
+		"ADMIN@oceanheart.ai":   models.RoleAdmin,
+		"someone@oceanheart.ai": models.RoleUser,
+		"":                      models.RoleUser,
+	}
+	for email, want := range tests {
+		if got := b.RoleFor(email); got != want {
+			t.Errorf("RoleFor(%q) = %q, want %q", email, got, want)
+		}
+	}
+
+	b.SetPolicy([]string{"someone@oceanheart.ai"}, false)
+	if b.RoleFor("admin@oceanheart.ai") != models.RoleUser || b.RoleFor("someone@oceanheart.ai") != models.RoleAdmin {
+		t.Error("SetPolicy() didn't replace the admin list")
+	}
+
+	var unset *AdminBootstrap
+	if unset.RoleFor("admin@oceanheart.ai") != models.RoleUser {
+		t.Error("nil AdminBootstrap granted admin")
+	}
+}
@@ -4,72 +4,100 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 
 	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/metrics"
 	"github.com/oceanheart/go-passport/internal/models"
 	"github.com/oceanheart/go-passport/internal/repository"
+	"github.com/oceanheart/go-passport/internal/tracing"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid email or password")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrSessionNotFound    = errors.New("session not found")
+	ErrTokenRevoked       = errors.New("token has been revoked")
 )
 
 type AuthService struct {
-	userRepo        *repository.UserRepository
-	sessionRepo     *repository.SessionRepository
+	userRepo        repository.UserStore
+	sessionRepo     repository.SessionStore
+	tx              repository.Transactor
 	passwordService *auth.PasswordService
 	jwtService      *auth.JWTService
+	enricher        *SessionEnricher
+	deviceAlerts    *DeviceAlertService
+	admins          *AdminBootstrap
+	logger          *slog.Logger
+	metrics         *metrics.Metrics
 }
 
 func NewAuthService(
-	userRepo *repository.UserRepository,
-	sessionRepo *repository.SessionRepository,
+	userRepo repository.UserStore,
+	sessionRepo repository.SessionStore,
+	tx repository.Transactor,
 	passwordService *auth.PasswordService,
 	jwtService *auth.JWTService,
+	enricher *SessionEnricher,
+	deviceAlerts *DeviceAlertService,
+	admins *AdminBootstrap,
+	logger *slog.Logger,
+	metrics *metrics.Metrics,
 ) *AuthService {
 	return &AuthService{
 		userRepo:        userRepo,
 		sessionRepo:     sessionRepo,
+		tx:              tx,
 		passwordService: passwordService,
 		jwtService:      jwtService,
+		enricher:        enricher,
+		deviceAlerts:    deviceAlerts,
+		admins:          admins,
+		logger:          logger,
+		metrics:         metrics,
 	}
 }
 
-func (s *AuthService) SignUp(ctx context.Context, params models.UserCreateParams) (*models.User, *models.Session, string, error) {
+func (s *AuthService) SignUp(ctx context.Context, params models.UserCreateParams, ipAddress, userAgent string) (*models.User, *models.Session, string, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.SignUp")
+	defer span.End()
+
 	// Validate password strength
 	if err := s.passwordService.ValidatePasswordStrength(params.Password); err != nil {
 		return nil, nil, "", err
 	}
 
-	// Hash password
-	hashedPassword, err := s.passwordService.HashPassword(params.Password)
+	hashedPassword, err := s.hashPassword(ctx, params.Password)
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Create user
-	user := &models.User{
-		EmailAddress:   params.EmailAddress,
-		PasswordDigest: hashedPassword,
-		Role:          models.RoleUser,
-	}
-
-	if err := s.userRepo.Create(ctx, user); err != nil {
-		if errors.Is(err, repository.ErrUserAlreadyExists) {
-			return nil, nil, "", errors.New("email already taken")
-		}
-		return nil, nil, "", fmt.Errorf("failed to create user: %w", err)
-	}
-
-	// Create session
 	session := &models.Session{
-		UserID: user.ID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
 	}
+	s.enricher.Enrich(session)
+
+	// Create the user, as admin if listed in ADMIN_EMAILS, together with
+	// their session, so a failure doesn't leave behind an account that can't
+	// sign up again
+	var user *models.User
+	err = s.tx.Transact(ctx, func(ctx context.Context) error {
+		user, err = s.createUser(ctx, params.EmailAddress, hashedPassword, s.admins.RoleFor(params.EmailAddress))
+		if err != nil {
+			return err
+		}
 
-	if err := s.sessionRepo.Create(ctx, session); err != nil {
-		return nil, nil, "", fmt.Errorf("failed to create session: %w", err)
+		session.UserID = user.ID
+		if err := s.sessionRepo.Create(ctx, session); err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		s.metrics.SignUp(false)
+		return nil, nil, "", err
 	}
 
 	// Generate JWT token
@@ -78,45 +106,122 @@ func (s *AuthService) SignUp(ctx context.Context, params models.UserCreateParams
 		return nil, nil, "", fmt.Errorf("failed to generate token: %w", err)
 	}
 
+	s.logger.InfoContext(ctx, "user signed up", "target_user_id", user.ID, "new_session_id", session.ID, "role", user.Role)
+	s.metrics.SignUp(true)
+
 	return user, session, token, nil
 }
 
+// CreateUser creates an account with the given role without signing it in,
+// e.g. from the admin CLI.
+func (s *AuthService) CreateUser(ctx context.Context, params models.UserCreateParams, role models.UserRole) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.CreateUser")
+	defer span.End()
+
+	if err := s.passwordService.ValidatePasswordStrength(params.Password); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.hashPassword(ctx, params.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user, err := s.createUser(ctx, params.EmailAddress, hashedPassword, role)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "user created", "target_user_id", user.ID, "role", user.Role)
+
+	return user, nil
+}
+
+func (s *AuthService) createUser(ctx context.Context, email, hashedPassword string, role models.UserRole) (*models.User, error) {
+	user := &models.User{
+		EmailAddress:   email,
+		PasswordDigest: hashedPassword,
+		Role:           role,
+	}
+
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrUserAlreadyExists) {
+			return nil, errors.New("email already taken")
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return user, nil
+}
+
 func (s *AuthService) SignIn(ctx context.Context, email, password, ipAddress, userAgent string) (*models.User, *models.Session, string, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.SignIn")
+	defer span.End()
+
 	// Find user by email
 	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
+			s.logger.WarnContext(ctx, "sign-in failed", "reason", "unknown_email", "ip", ipAddress)
+			s.metrics.SignIn(metrics.SignInUnknownEmail)
 			return nil, nil, "", ErrInvalidCredentials
 		}
+		s.metrics.SignIn(metrics.SignInError)
 		return nil, nil, "", fmt.Errorf("failed to find user: %w", err)
 	}
 
 	// Verify password
-	if err := s.passwordService.ComparePassword(user.PasswordDigest, password); err != nil {
+	if err := s.comparePassword(ctx, user.PasswordDigest, password); err != nil {
+		s.logger.WarnContext(ctx, "sign-in failed", "reason", "wrong_password", "ip", ipAddress, "target_user_id", user.ID)
+		s.metrics.SignIn(metrics.SignInWrongPassword)
 		return nil, nil, "", ErrInvalidCredentials
 	}
 
+	// Load existing sessions so the new device can be compared against them
+	var history []*models.Session
+	if s.deviceAlerts.Enabled() {
+		history, err = s.sessionRepo.FindByUserID(ctx, user.ID)
+		if err != nil {
+			s.metrics.SignIn(metrics.SignInError)
+			return nil, nil, "", fmt.Errorf("failed to find sessions: %w", err)
+		}
+	}
+
 	// Create session
 	session := &models.Session{
 		UserID:    user.ID,
 		IPAddress: ipAddress,
 		UserAgent: userAgent,
 	}
+	s.enricher.Enrich(session)
 
 	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		s.metrics.SignIn(metrics.SignInError)
 		return nil, nil, "", fmt.Errorf("failed to create session: %w", err)
 	}
 
+	// Alert the user about sign-ins from unfamiliar devices
+	if s.deviceAlerts.IsNewDevice(history, session) {
+		s.deviceAlerts.NotifyAsync(ctx, user, session)
+	}
+
 	// Generate JWT token
 	token, err := s.jwtService.GenerateToken(user)
 	if err != nil {
+		s.metrics.SignIn(metrics.SignInError)
 		return nil, nil, "", fmt.Errorf("failed to generate token: %w", err)
 	}
 
+	s.logger.InfoContext(ctx, "user signed in", "target_user_id", user.ID, "new_session_id", session.ID, "ip", ipAddress)
+	s.metrics.SignIn(metrics.SignInSuccess)
+
 	return user, session, token, nil
 }
 
 func (s *AuthService) SignOut(ctx context.Context, sessionID int64) error {
+	ctx, span := tracing.Start(ctx, "AuthService.SignOut")
+	defer span.End()
+
 	if err := s.sessionRepo.Delete(ctx, sessionID); err != nil {
 		if errors.Is(err, repository.ErrSessionNotFound) {
 			return ErrSessionNotFound
@@ -124,10 +229,15 @@ func (s *AuthService) SignOut(ctx context.Context, sessionID int64) error {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
 
+	s.logger.InfoContext(ctx, "user signed out", "ended_session_id", sessionID)
+
 	return nil
 }
 
 func (s *AuthService) SignOutAllSessions(ctx context.Context, userID int64) error {
+	ctx, span := tracing.Start(ctx, "AuthService.SignOutAllSessions")
+	defer span.End()
+
 	if err := s.sessionRepo.DeleteByUserID(ctx, userID); err != nil {
 		return fmt.Errorf("failed to delete all sessions: %w", err)
 	}
@@ -145,32 +255,46 @@ func (s *AuthService) ValidateToken(tokenString string) (*auth.Claims, error) {
 }
 
 func (s *AuthService) RefreshToken(ctx context.Context, claims *auth.Claims) (string, error) {
-	// Verify user still exists
-	_, err := s.userRepo.FindByID(ctx, claims.UserID)
-	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			return "", ErrUserNotFound
-		}
-		return "", fmt.Errorf("failed to find user: %w", err)
+	ctx, span := tracing.Start(ctx, "AuthService.RefreshToken")
+	defer span.End()
+
+	// Verify user still exists and the token hasn't been revoked
+	if _, err := s.GetUserFromClaims(ctx, claims); err != nil {
+		s.metrics.TokenRefresh(false)
+		return "", err
 	}
 
 	// Generate new token
 	token, err := s.jwtService.RefreshToken(claims)
 	if err != nil {
+		s.metrics.TokenRefresh(false)
 		return "", fmt.Errorf("failed to refresh token: %w", err)
 	}
 
+	s.metrics.TokenRefresh(true)
 	return token, nil
 }
 
 func (s *AuthService) GetUserFromToken(ctx context.Context, tokenString string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetUserFromToken")
+	defer span.End()
+
 	// Validate token
 	claims, err := s.jwtService.ValidateToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get user
+	return s.GetUserFromClaims(ctx, claims)
+}
+
+// GetUserFromClaims loads the user for claims that have already been
+// validated, avoiding a second signature check. Tokens issued before the
+// user's tokens were last revoked are rejected with ErrTokenRevoked.
+func (s *AuthService) GetUserFromClaims(ctx context.Context, claims *auth.Claims) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetUserFromClaims")
+	defer span.End()
+
 	user, err := s.userRepo.FindByID(ctx, claims.UserID)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -179,10 +303,17 @@ func (s *AuthService) GetUserFromToken(ctx context.Context, tokenString string)
 		return nil, fmt.Errorf("failed to find user: %w", err)
 	}
 
+	if claims.Generation != user.TokenGeneration {
+		return nil, ErrTokenRevoked
+	}
+
 	return user, nil
 }
 
 func (s *AuthService) GetUserFromSession(ctx context.Context, sessionID int64) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetUserFromSession")
+	defer span.End()
+
 	// Get session
 	session, err := s.sessionRepo.FindByID(ctx, sessionID)
 	if err != nil {
@@ -205,6 +336,9 @@ func (s *AuthService) GetUserFromSession(ctx context.Context, sessionID int64) (
 }
 
 func (s *AuthService) UpdatePassword(ctx context.Context, userID int64, oldPassword, newPassword string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.UpdatePassword")
+	defer span.End()
+
 	// Get user
 	user, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil {
@@ -215,31 +349,76 @@ func (s *AuthService) UpdatePassword(ctx context.Context, userID int64, oldPassw
 	}
 
 	// Verify old password
-	if err := s.passwordService.ComparePassword(user.PasswordDigest, oldPassword); err != nil {
+	if err := s.comparePassword(ctx, user.PasswordDigest, oldPassword); err != nil {
 		return ErrInvalidCredentials
 	}
 
+	return s.setPassword(ctx, user, newPassword)
+}
+
+// SetPassword replaces a user's password without knowing the old one and
+// signs them out everywhere, e.g. from the admin CLI.
+func (s *AuthService) SetPassword(ctx context.Context, userID int64, newPassword string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.SetPassword")
+	defer span.End()
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if err := s.setPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "password set by administrator", "target_user_id", userID)
+
+	return nil
+}
+
+func (s *AuthService) setPassword(ctx context.Context, user *models.User, newPassword string) error {
 	// Validate new password
 	if err := s.passwordService.ValidatePasswordStrength(newPassword); err != nil {
 		return err
 	}
 
 	// Hash new password
-	hashedPassword, err := s.passwordService.HashPassword(newPassword)
+	hashedPassword, err := s.hashPassword(ctx, newPassword)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Update user
+	// Update user and invalidate all sessions and tokens, together so that
+	// sessions can't survive a password change
 	user.PasswordDigest = hashedPassword
-	if err := s.userRepo.Update(ctx, user); err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
-	}
+	user.TokenGeneration++
+	return s.tx.Transact(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
 
-	// Invalidate all sessions
-	if err := s.sessionRepo.DeleteByUserID(ctx, userID); err != nil {
-		return fmt.Errorf("failed to delete sessions: %w", err)
-	}
+		if err := s.sessionRepo.DeleteByUserID(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed to delete sessions: %w", err)
+		}
+		return nil
+	})
+}
 
-	return nil
-}
\ No newline at end of file
+// hashPassword and comparePassword run bcrypt in their own spans; they
+// usually dominate sign-up and sign-in latency.
+func (s *AuthService) hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt.Hash")
+	defer span.End()
+
+	return s.passwordService.HashPassword(password)
+}
+
+func (s *AuthService) comparePassword(ctx context.Context, digest, password string) error {
+	_, span := tracing.Start(ctx, "bcrypt.Compare")
+	defer span.End()
+
+	return s.passwordService.ComparePassword(digest, password)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/models"
+	"github.com/oceanheart/go-passport/internal/repository"
+)
+
+func newTestAuthService(t *testing.T) (*AuthService, *repository.MemoryStore) {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	admins := NewAdminBootstrap(store.Users(), []string{"admin@example.com"}, false, logger)
+	s := NewAuthService(store.Users(), store.Sessions(), store, auth.NewPasswordService(), auth.NewJWTService("test-secret", "passport-test"),
+		NewSessionEnricher(nil), nil, admins, logger, nil)
+	return s, store
+}
+
+func TestAuthServiceSignUpAndSignIn(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestAuthService(t)
+
+	user, session, token, err := s.SignUp(ctx, models.UserCreateParams{EmailAddress: "Admin@Example.com", Password: "Password123"}, "203.0.113.5", "curl/8.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != models.RoleAdmin || session.UserID != user.ID || token == "" {
+		t.Fatalf("SignUp() = %+v, %+v, %q", user, session, token)
+	}
+	if _, _, _, err := s.SignUp(ctx, models.UserCreateParams{EmailAddress: "admin@example.com", Password: "Password123"}, "", ""); err == nil {
+		t.Fatal("SignUp() with a taken email succeeded")
+	}
+
+	if _, _, _, err := s.SignIn(ctx, "admin@example.com", "wrong", "", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("SignIn(wrong password) error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, _, _, err := s.SignIn(ctx, "nobody@example.com", "Password123", "", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("SignIn(unknown email) error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, _, _, err := s.SignIn(ctx, "ADMIN@example.com", "Password123", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := store.Sessions().CountByUserID(ctx, user.ID); count != 2 {
+		t.Fatalf("sessions after sign-in = %d, want 2", count)
+	}
+
+	found, err := s.GetUserFromToken(ctx, token)
+	if err != nil || found.ID != user.ID {
+		t.Fatalf("GetUserFromToken() = %+v, %v", found, err)
+	}
+}
+
+// failingSessions fails to create sessions.
+type failingSessions struct {
+	repository.SessionStore
+}
+
+func (failingSessions) Create(ctx context.Context, session *models.Session) error {
+	return errors.New("connection reset")
+}
+
+func TestAuthServiceSignUpIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestAuthService(t)
+	s.sessionRepo = failingSessions{store.Sessions()}
+
+	params := models.UserCreateParams{EmailAddress: "alice@example.com", Password: "Password123"}
+	if _, _, _, err := s.SignUp(ctx, params, "", ""); err == nil {
+		t.Fatal("SignUp() succeeded without a session")
+	}
+	if _, err := store.Users().FindByEmail(ctx, "alice@example.com"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("FindByEmail() after a failed sign-up error = %v, want ErrUserNotFound", err)
+	}
+
+	s.sessionRepo = store.Sessions()
+	if _, _, _, err := s.SignUp(ctx, params, "", ""); err != nil {
+		t.Fatalf("SignUp() again = %v", err)
+	}
+}
+
+func TestAuthServiceUpdatePassword(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestAuthService(t)
+
+	user, _, _, err := s.SignUp(ctx, models.UserCreateParams{EmailAddress: "alice@example.com", Password: "Password123"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UpdatePassword(ctx, user.ID, "wrong", "NewPassword456"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("UpdatePassword(wrong old password) error = %v, want ErrInvalidCredentials", err)
+	}
+	if err := s.UpdatePassword(ctx, user.ID, "Password123", "NewPassword456"); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := store.Sessions().CountByUserID(ctx, user.ID); count != 0 {
+		t.Fatalf("sessions after password change = %d, want 0", count)
+	}
+	if _, _, _, err := s.SignIn(ctx, "alice@example.com", "NewPassword456", "", ""); err != nil {
+		t.Fatalf("SignIn() with the new password: %v", err)
+	}
+
+	if err := s.SetPassword(ctx, user.ID+1000, "NewPassword456"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("SetPassword(unknown user) error = %v, want ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/mail"
+	"github.com/oceanheart/go-passport/internal/models"
+	"github.com/oceanheart/go-passport/internal/repository"
+)
+
+const (
+	unrecognizedSessionPurpose = "session-not-me"
+	unrecognizedSessionTTL     = 7 * 24 * time.Hour
+	deviceAlertTimeout         = 30 * time.Second
+)
+
+var ErrInvalidAlertToken = errors.New("this link is invalid or has expired")
+
+// DeviceAlertService emails users when they sign in from a browser/IP
+// combination that doesn't appear in their session history, and handles the
+// "this wasn't me" link included in that email.
+type DeviceAlertService struct {
+	userRepo        repository.UserStore
+	sessionRepo     repository.SessionStore
+	tx              repository.Transactor
+	passwordService *auth.PasswordService
+	passwordResets  *PasswordResetService
+	mailer          mail.Mailer
+	signer          *auth.TokenSigner
+	appURL          string
+	enabled         bool
+	logger          *slog.Logger
+}
+
+func NewDeviceAlertService(
+	userRepo repository.UserStore,
+	sessionRepo repository.SessionStore,
+	tx repository.Transactor,
+	passwordService *auth.PasswordService,
+	passwordResets *PasswordResetService,
+	mailer mail.Mailer,
+	signer *auth.TokenSigner,
+	appURL string,
+	enabled bool,
+	logger *slog.Logger,
+) *DeviceAlertService {
+	return &DeviceAlertService{
+		userRepo:        userRepo,
+		sessionRepo:     sessionRepo,
+		tx:              tx,
+		passwordService: passwordService,
+		passwordResets:  passwordResets,
+		mailer:          mailer,
+		signer:          signer,
+		appURL:          strings.TrimRight(appURL, "/"),
+		enabled:         enabled,
+		logger:          logger,
+	}
+}
+
+func (s *DeviceAlertService) Enabled() bool {
+	return s != nil && s.enabled
+}
+
+// IsNewDevice reports whether session comes from a browser/IP combination
+// not present in history. Browser and OS versions are ignored so routine
+// updates don't trigger alerts. With no history there is nothing to compare
+// against (e.g. the user signed out everywhere), so no alert is raised.
+func (s *DeviceAlertService) IsNewDevice(history []*models.Session, session *models.Session) bool {
+	if !s.Enabled() || len(history) == 0 {
+		return false
+	}
+
+	fingerprint := deviceFingerprint(session)
+	for _, previous := range history {
+		if previous.ID != session.ID && deviceFingerprint(previous) == fingerprint {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NotifyAsync sends the new device email in the background so sign-in
+// latency doesn't depend on the mail server.
+func (s *DeviceAlertService) NotifyAsync(ctx context.Context, user *models.User, session *models.Session) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, deviceAlertTimeout)
+		defer cancel()
+
+		if err := s.NotifyNewDevice(ctx, user, session); err != nil {
+			s.logger.ErrorContext(ctx, "failed to send new device alert", "target_user_id", user.ID, "error", err)
+		}
+	}()
+}
+
+func (s *DeviceAlertService) NotifyNewDevice(ctx context.Context, user *models.User, session *models.Session) error {
+	subject := strconv.FormatInt(user.ID, 10) + ":" + strconv.FormatInt(session.ID, 10) + ":" + digestFingerprint(user.PasswordDigest)
+	token := s.signer.Sign(unrecognizedSessionPurpose, subject, unrecognizedSessionTTL)
+	link := s.appURL + "/sessions/not_me?token=" + url.QueryEscape(token)
+
+	location := session.Location()
+	if location == "" {
+		location = "Unknown location"
+	}
+
+	msg := mail.Message{
+		To:      user.EmailAddress,
+		Subject: "New sign-in to your Passport account",
+		Body: fmt.Sprintf(`Hello,
+
+Your Passport account was just signed in to from a new device.
+
+  Device:   %s (%s)
+  Location: %s
+  IP:       %s
+  Time:     %s
+
+If this was you, there's nothing to do.
+
+If this wasn't you, use the link below to end that session and reset your
+password:
+
+%s
+`, session.DeviceSummary(), session.DeviceType, location, session.IPAddress,
+			session.CreatedAt.UTC().Format("Jan 2, 2006 15:04 MST"), link),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send new device email: %w", err)
+	}
+
+	return nil
+}
+
+// ValidateToken returns the user and session ID a "this wasn't me" token was
+// issued for. Like a password reset token, it embeds a fingerprint of the
+// password digest, so reporting, which replaces the password, uses it up.
+// It keeps working after the reported session has ended.
+func (s *DeviceAlertService) ValidateToken(ctx context.Context, token string) (*models.User, int64, error) {
+	subject, err := s.signer.Verify(unrecognizedSessionPurpose, token)
+	if err != nil {
+		return nil, 0, ErrInvalidAlertToken
+	}
+
+	parts := strings.Split(subject, ":")
+	if len(parts) != 3 {
+		return nil, 0, ErrInvalidAlertToken
+	}
+	userIDStr, sessionIDStr, fingerprint := parts[0], parts[1], parts[2]
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, 0, ErrInvalidAlertToken
+	}
+	sessionID, err := strconv.ParseInt(sessionIDStr, 10, 64)
+	if err != nil {
+		return nil, 0, ErrInvalidAlertToken
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, 0, ErrInvalidAlertToken
+		}
+		return nil, 0, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if digestFingerprint(user.PasswordDigest) != fingerprint {
+		return nil, 0, ErrInvalidAlertToken
+	}
+
+	return user, sessionID, nil
+}
+
+// ReportUnrecognizedSession handles "this wasn't me": it revokes every
+// session and JWT of the user, replaces the password with a random one so the
+// leaked credentials stop working, and emails a password reset link. A token
+// can be used once.
+func (s *DeviceAlertService) ReportUnrecognizedSession(ctx context.Context, token string) error {
+	user, sessionID, err := s.ValidateToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	randomPassword, err := generateRandomPassword()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := s.passwordService.HashPassword(randomPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err = s.tx.Transact(ctx, func(ctx context.Context) error {
+		// Check the token again against the password in the transaction, so
+		// a concurrent report doesn't rotate the password a second time
+		current, err := s.userRepo.FindByID(ctx, user.ID)
+		if err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				return ErrInvalidAlertToken
+			}
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+		if current.PasswordDigest != user.PasswordDigest {
+			return ErrInvalidAlertToken
+		}
+
+		// The reported session may already have ended, e.g. the attacker
+		// signed out; the account still needs locking down
+		if err := s.sessionRepo.Delete(ctx, sessionID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+
+		if err := s.sessionRepo.DeleteByUserID(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed to delete sessions: %w", err)
+		}
+
+		current.PasswordDigest = hashedPassword
+		current.TokenGeneration++
+		if err := s.userRepo.Update(ctx, current); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		user = current
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.WarnContext(ctx, "unrecognized session reported, account locked down", "target_user_id", user.ID, "reported_session_id", sessionID)
+
+	return s.passwordResets.SendResetEmail(ctx, user)
+}
+
+func deviceFingerprint(session *models.Session) string {
+	return withoutVersion(session.Browser) + "|" + withoutVersion(session.OS) + "|" + session.IPAddress
+}
+
+// withoutVersion strips a trailing version from names like "Chrome 120" or
+// "macOS 10.15".
+func withoutVersion(name string) string {
+	if i := strings.LastIndex(name, " "); i > 0 {
+		if _, err := strconv.ParseFloat(name[i+1:], 64); err == nil {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+func generateRandomPassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/mail/mailtest"
+	"github.com/oceanheart/go-passport/internal/models"
+	"github.com/oceanheart/go-passport/internal/repository"
+)
+
+// newTestDeviceAlertService returns a device alert service and an auth
+// service that uses it, sharing a memory store and a recording mailer.
+func newTestDeviceAlertService(t *testing.T) (*DeviceAlertService, *AuthService, *repository.MemoryStore, *mailtest.Recorder) {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mailer := &mailtest.Recorder{}
+	passwords := auth.NewPasswordService()
+	signer := auth.NewTokenSigner("test-secret")
+	resets := NewPasswordResetService(store.Users(), store.Sessions(), store, passwords, mailer, signer, "https://passport.test", logger)
+	alerts := NewDeviceAlertService(store.Users(), store.Sessions(), store, passwords, resets, mailer, signer, "https://passport.test", true, logger)
+	authService := NewAuthService(store.Users(), store.Sessions(), store, passwords, auth.NewJWTService("test-secret", "passport-test"),
+		NewSessionEnricher(nil), alerts, nil, logger, nil)
+	return alerts, authService, store, mailer
+}
+
+func TestReportUnrecognizedSessionOnlyOnce(t *testing.T) {
+	ctx := context.Background()
+	s, _, store, mailer := newTestDeviceAlertService(t)
+
+	user := &models.User{EmailAddress: "alice@example.com", PasswordDigest: "digest"}
+	if err := store.Users().Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	session := &models.Session{UserID: user.ID, IPAddress: "198.51.100.7"}
+	if err := store.Sessions().Create(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.NotifyNewDevice(ctx, user, session); err != nil {
+		t.Fatal(err)
+	}
+	token := mailtest.LinkToken(t, mailer.Sent[0].Body)
+
+	if err := s.ReportUnrecognizedSession(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := store.Sessions().CountByUserID(ctx, user.ID); count != 0 {
+		t.Fatalf("sessions after report = %d, want 0", count)
+	}
+
+	// The user resets their password and signs in again; replaying the
+	// token must not lock them out a second time
+	reset, err := store.Users().FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset.PasswordDigest = "new-digest"
+	if err := store.Users().Update(ctx, reset); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Sessions().Create(ctx, &models.Session{UserID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.ValidateToken(ctx, token); !errors.Is(err, ErrInvalidAlertToken) {
+		t.Fatalf("ValidateToken(used token) error = %v, want ErrInvalidAlertToken", err)
+	}
+	if err := s.ReportUnrecognizedSession(ctx, token); !errors.Is(err, ErrInvalidAlertToken) {
+		t.Fatalf("ReportUnrecognizedSession(used token) error = %v, want ErrInvalidAlertToken", err)
+	}
+	if found, _ := store.Users().FindByID(ctx, user.ID); found.PasswordDigest != "new-digest" {
+		t.Fatal("replaying the token replaced the password")
+	}
+	if count, _ := store.Sessions().CountByUserID(ctx, user.ID); count != 1 {
+		t.Fatalf("sessions after replay = %d, want 1", count)
+	}
+}
+
+// Ending the reported session, or its purge, mustn't stop the user from
+// locking the attacker out.
+func TestReportUnrecognizedSessionAfterSignOut(t *testing.T) {
+	ctx := context.Background()
+	s, authService, store, mailer := newTestDeviceAlertService(t)
+
+	user, session, jwt, err := authService.SignUp(ctx, models.UserCreateParams{EmailAddress: "alice@example.com", Password: "Password123"}, "198.51.100.7", "curl/8.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.NotifyNewDevice(ctx, user, session); err != nil {
+		t.Fatal(err)
+	}
+	token := mailtest.LinkToken(t, mailer.Sent[0].Body)
+
+	if err := authService.SignOut(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReportUnrecognizedSession(ctx, token); err != nil {
+		t.Fatalf("ReportUnrecognizedSession() after sign-out error = %v", err)
+	}
+
+	if _, _, _, err := authService.SignIn(ctx, "alice@example.com", "Password123", "", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("SignIn(old password) error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := authService.GetUserFromToken(ctx, jwt); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("GetUserFromToken(earlier JWT) error = %v, want ErrTokenRevoked", err)
+	}
+	if len(mailer.Sent) != 2 || mailer.Sent[1].Subject != "Reset your Passport password" {
+		t.Fatalf("sent %d messages, want the alert and a reset link", len(mailer.Sent))
+	}
+	if err := s.ReportUnrecognizedSession(ctx, token); !errors.Is(err, ErrInvalidAlertToken) {
+		t.Fatalf("ReportUnrecognizedSession(used token) error = %v, want ErrInvalidAlertToken", err)
+	}
+	if count, _ := store.Sessions().CountByUserID(ctx, user.ID); count != 0 {
+		t.Fatalf("sessions after report = %d, want 0", count)
+	}
+}
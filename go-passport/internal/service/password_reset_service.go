@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oceanheart/go-passport/internal/auth"
+	"github.com/oceanheart/go-passport/internal/mail"
+	"github.com/oceanheart/go-passport/internal/models"
+	"github.com/oceanheart/go-passport/internal/repository"
+)
+
+const (
+	passwordResetPurpose = "password-reset"
+	passwordResetTTL     = time.Hour
+)
+
+var ErrInvalidResetToken = errors.New("password reset link is invalid or has expired")
+
+type PasswordResetService struct {
+	userRepo        repository.UserStore
+	sessionRepo     repository.SessionStore
+	tx              repository.Transactor
+	passwordService *auth.PasswordService
+	mailer          mail.Mailer
+	signer          *auth.TokenSigner
+	appURL          string
+	logger          *slog.Logger
+}
+
+func NewPasswordResetService(
+	userRepo repository.UserStore,
+	sessionRepo repository.SessionStore,
+	tx repository.Transactor,
+	passwordService *auth.PasswordService,
+	mailer mail.Mailer,
+	signer *auth.TokenSigner,
+	appURL string,
+	logger *slog.Logger,
+) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:        userRepo,
+		sessionRepo:     sessionRepo,
+		tx:              tx,
+		passwordService: passwordService,
+		mailer:          mailer,
+		signer:          signer,
+		appURL:          strings.TrimRight(appURL, "/"),
+		logger:          logger,
+	}
+}
+
+// SendResetEmail emails the user a single-use link to choose a new password.
+// The token embeds a fingerprint of the current password digest, so it stops
+// working as soon as the password changes.
+func (s *PasswordResetService) SendResetEmail(ctx context.Context, user *models.User) error {
+	subject := strconv.FormatInt(user.ID, 10) + ":" + digestFingerprint(user.PasswordDigest)
+	token := s.signer.Sign(passwordResetPurpose, subject, passwordResetTTL)
+	link := s.appURL + "/password/reset?token=" + url.QueryEscape(token)
+
+	msg := mail.Message{
+		To:      user.EmailAddress,
+		Subject: "Reset your Passport password",
+		Body: fmt.Sprintf(`Hello,
+
+Use the link below to choose a new password for your Passport account. The
+link expires in %d minutes and can only be used once.
+
+%s
+
+If you didn't request this, you can ignore this email.
+`, int(passwordResetTTL.Minutes()), link),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "password reset email sent", "target_user_id", user.ID)
+
+	return nil
+}
+
+// ValidateToken returns the user a reset token was issued for.
+func (s *PasswordResetService) ValidateToken(ctx context.Context, token string) (*models.User, error) {
+	subject, err := s.signer.Verify(passwordResetPurpose, token)
+	if err != nil {
+		return nil, ErrInvalidResetToken
+	}
+
+	idStr, fingerprint, ok := strings.Cut(subject, ":")
+	if !ok {
+		return nil, ErrInvalidResetToken
+	}
+	userID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if digestFingerprint(user.PasswordDigest) != fingerprint {
+		return nil, ErrInvalidResetToken
+	}
+
+	return user, nil
+}
+
+// ResetPassword sets a new password and signs the user out everywhere.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) (*models.User, error) {
+	user, err := s.ValidateToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.passwordService.ValidatePasswordStrength(newPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwordService.HashPassword(newPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user.PasswordDigest = hashedPassword
+	user.TokenGeneration++
+	err = s.tx.Transact(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+
+		if err := s.sessionRepo.DeleteByUserID(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed to delete sessions: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "password reset", "target_user_id", user.ID)
+
+	return user, nil
+}
+
+func digestFingerprint(digest string) string {
+	sum := sha256.Sum256([]byte(digest))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"github.com/oceanheart/go-passport/internal/geoip"
+	"github.com/oceanheart/go-passport/internal/models"
+	"github.com/oceanheart/go-passport/internal/useragent"
+)
+
+// SessionEnricher fills in the human readable device and location fields of
+// a session from its raw user agent and IP address.
+type SessionEnricher struct {
+	geoIP *geoip.Reader
+}
+
+// NewSessionEnricher creates an enricher. geoIP may be nil, in which case
+// sessions are stored without a location.
+func NewSessionEnricher(geoIP *geoip.Reader) *SessionEnricher {
+	return &SessionEnricher{
+		geoIP: geoIP,
+	}
+}
+
+func (e *SessionEnricher) Enrich(session *models.Session) {
+	info := useragent.Parse(session.UserAgent)
+	session.Browser = info.Browser
+	session.OS = info.OS
+	session.DeviceType = string(info.DeviceType)
+
+	location := e.geoIP.Lookup(session.IPAddress)
+	session.Country = location.CountryCode
+	session.City = location.City
+}
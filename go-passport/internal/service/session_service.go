@@ -4,25 +4,34 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/oceanheart/go-passport/internal/models"
 	"github.com/oceanheart/go-passport/internal/repository"
+	"github.com/oceanheart/go-passport/internal/tracing"
 )
 
 type SessionService struct {
-	sessionRepo *repository.SessionRepository
-	userRepo    *repository.UserRepository
+	sessionRepo repository.SessionStore
+	userRepo    repository.UserStore
+	enricher    *SessionEnricher
+	logger      *slog.Logger
 }
 
-func NewSessionService(sessionRepo *repository.SessionRepository, userRepo *repository.UserRepository) *SessionService {
+func NewSessionService(sessionRepo repository.SessionStore, userRepo repository.UserStore, enricher *SessionEnricher, logger *slog.Logger) *SessionService {
 	return &SessionService{
 		sessionRepo: sessionRepo,
 		userRepo:     userRepo,
+		enricher:    enricher,
+		logger:      logger,
 	}
 }
 
 func (s *SessionService) GetSession(ctx context.Context, id int64) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.GetSession")
+	defer span.End()
+
 	session, err := s.sessionRepo.FindByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrSessionNotFound) {
@@ -35,6 +44,9 @@ func (s *SessionService) GetSession(ctx context.Context, id int64) (*models.Sess
 }
 
 func (s *SessionService) GetUserSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.GetUserSessions")
+	defer span.End()
+
 	sessions, err := s.sessionRepo.FindByUserID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find user sessions: %w", err)
@@ -44,6 +56,9 @@ func (s *SessionService) GetUserSessions(ctx context.Context, userID int64) ([]*
 }
 
 func (s *SessionService) CreateSession(ctx context.Context, userID int64, ipAddress, userAgent string) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.CreateSession")
+	defer span.End()
+
 	// Verify user exists
 	_, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil {
@@ -58,6 +73,7 @@ func (s *SessionService) CreateSession(ctx context.Context, userID int64, ipAddr
 		IPAddress: ipAddress,
 		UserAgent: userAgent,
 	}
+	s.enricher.Enrich(session)
 
 	if err := s.sessionRepo.Create(ctx, session); err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
@@ -67,6 +83,9 @@ func (s *SessionService) CreateSession(ctx context.Context, userID int64, ipAddr
 }
 
 func (s *SessionService) UpdateSession(ctx context.Context, sessionID int64, ipAddress, userAgent string) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.UpdateSession")
+	defer span.End()
+
 	session, err := s.sessionRepo.FindByID(ctx, sessionID)
 	if err != nil {
 		if errors.Is(err, repository.ErrSessionNotFound) {
@@ -77,6 +96,7 @@ func (s *SessionService) UpdateSession(ctx context.Context, sessionID int64, ipA
 
 	session.IPAddress = ipAddress
 	session.UserAgent = userAgent
+	s.enricher.Enrich(session)
 
 	if err := s.sessionRepo.Update(ctx, session); err != nil {
 		return nil, fmt.Errorf("failed to update session: %w", err)
@@ -86,36 +106,69 @@ func (s *SessionService) UpdateSession(ctx context.Context, sessionID int64, ipA
 }
 
 func (s *SessionService) DeleteSession(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "SessionService.DeleteSession")
+	defer span.End()
+
 	if err := s.sessionRepo.Delete(ctx, id); err != nil {
 		if errors.Is(err, repository.ErrSessionNotFound) {
 			return ErrSessionNotFound
 		}
-		return nil, fmt.Errorf("failed to delete session: %w", err)
+		return fmt.Errorf("failed to delete session: %w", err)
 	}
 
+	s.logger.InfoContext(ctx, "session terminated", "ended_session_id", id)
+
 	return nil
 }
 
 func (s *SessionService) DeleteUserSessions(ctx context.Context, userID int64) error {
+	ctx, span := tracing.Start(ctx, "SessionService.DeleteUserSessions")
+	defer span.End()
+
 	if err := s.sessionRepo.DeleteByUserID(ctx, userID); err != nil {
 		return fmt.Errorf("failed to delete user sessions: %w", err)
 	}
 
+	s.logger.InfoContext(ctx, "all sessions terminated", "target_user_id", userID)
+
 	return nil
 }
 
+// SessionMaxAge is the age past which CleanupExpiredSessions deletes sessions.
+const SessionMaxAge = 30 * 24 * time.Hour
+
 func (s *SessionService) CleanupExpiredSessions(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "SessionService.CleanupExpiredSessions")
+	defer span.End()
+
 	// Delete sessions older than 30 days
-	expiryDuration := 30 * 24 * time.Hour
-	
-	if err := s.sessionRepo.DeleteExpired(ctx, expiryDuration); err != nil {
+	if _, err := s.PurgeSessions(ctx, SessionMaxAge); err != nil {
 		return fmt.Errorf("failed to cleanup expired sessions: %w", err)
 	}
 
 	return nil
 }
 
+// PurgeSessions deletes sessions created more than olderThan ago and
+// returns how many were deleted.
+func (s *SessionService) PurgeSessions(ctx context.Context, olderThan time.Duration) (int64, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.PurgeSessions")
+	defer span.End()
+
+	deleted, err := s.sessionRepo.DeleteExpired(ctx, olderThan)
+	if err != nil {
+		return 0, err
+	}
+
+	s.logger.InfoContext(ctx, "sessions purged", "older_than", olderThan, "deleted", deleted)
+
+	return deleted, nil
+}
+
 func (s *SessionService) CountUserSessions(ctx context.Context, userID int64) (int64, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.CountUserSessions")
+	defer span.End()
+
 	count, err := s.sessionRepo.CountByUserID(ctx, userID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count user sessions: %w", err)
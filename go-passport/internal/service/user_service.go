@@ -4,22 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 
 	"github.com/oceanheart/go-passport/internal/models"
 	"github.com/oceanheart/go-passport/internal/repository"
+	"github.com/oceanheart/go-passport/internal/tracing"
 )
 
 type UserService struct {
-	userRepo *repository.UserRepository
+	userRepo repository.UserStore
+	logger   *slog.Logger
 }
 
-func NewUserService(userRepo *repository.UserRepository) *UserService {
+func NewUserService(userRepo repository.UserStore, logger *slog.Logger) *UserService {
 	return &UserService{
 		userRepo: userRepo,
+		logger:   logger,
 	}
 }
 
 func (s *UserService) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByID")
+	defer span.End()
+
 	user, err := s.userRepo.FindByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -32,6 +39,9 @@ func (s *UserService) GetUserByID(ctx context.Context, id int64) (*models.User,
 }
 
 func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByEmail")
+	defer span.End()
+
 	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -44,6 +54,9 @@ func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models
 }
 
 func (s *UserService) ListUsers(ctx context.Context, page, perPage int) ([]*models.User, int64, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ListUsers")
+	defer span.End()
+
 	offset := (page - 1) * perPage
 	
 	users, err := s.userRepo.List(ctx, offset, perPage)
@@ -60,6 +73,9 @@ func (s *UserService) ListUsers(ctx context.Context, page, perPage int) ([]*mode
 }
 
 func (s *UserService) SearchUsers(ctx context.Context, query string, page, perPage int) ([]*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.SearchUsers")
+	defer span.End()
+
 	offset := (page - 1) * perPage
 	
 	users, err := s.userRepo.Search(ctx, query, offset, perPage)
@@ -71,6 +87,9 @@ func (s *UserService) SearchUsers(ctx context.Context, query string, page, perPa
 }
 
 func (s *UserService) UpdateUser(ctx context.Context, id int64, params models.UserUpdateParams) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+
 	user, err := s.userRepo.FindByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -97,10 +116,15 @@ func (s *UserService) UpdateUser(ctx context.Context, id int64, params models.Us
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
 
+	s.logger.InfoContext(ctx, "user updated", "target_user_id", user.ID, "role", user.Role)
+
 	return user, nil
 }
 
 func (s *UserService) ToggleUserRole(ctx context.Context, id int64) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ToggleUserRole")
+	defer span.End()
+
 	user, err := s.userRepo.FindByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -119,11 +143,43 @@ func (s *UserService) ToggleUserRole(ctx context.Context, id int64) (*models.Use
 		return nil, fmt.Errorf("failed to update user role: %w", err)
 	}
 
+	s.logger.InfoContext(ctx, "user role changed", "target_user_id", id, "role", newRole)
+
 	user.Role = newRole
 	return user, nil
 }
 
+// SetUserRole gives a user the role, doing nothing if they already have it.
+func (s *UserService) SetUserRole(ctx context.Context, id int64, role models.UserRole) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetUserRole")
+	defer span.End()
+
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if user.Role == role {
+		return user, nil
+	}
+
+	if err := s.userRepo.UpdateRole(ctx, id, role); err != nil {
+		return nil, fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "user role changed", "target_user_id", id, "role", role)
+
+	user.Role = role
+	return user, nil
+}
+
 func (s *UserService) DeleteUser(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer span.End()
+
 	if err := s.userRepo.Delete(ctx, id); err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			return ErrUserNotFound
@@ -131,10 +187,15 @@ func (s *UserService) DeleteUser(ctx context.Context, id int64) error {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
+	s.logger.InfoContext(ctx, "user deleted", "target_user_id", id)
+
 	return nil
 }
 
 func (s *UserService) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	ctx, span := tracing.Start(ctx, "UserService.IsAdmin")
+	defer span.End()
+
 	user, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
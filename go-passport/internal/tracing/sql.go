@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var sqlTarget = regexp.MustCompile(`(?i)\b(?:from|into|update|table)\s+(?:if\s+(?:not\s+)?exists\s+)?([a-z_][a-z0-9_.]*)`)
+
+// StartQuery starts a client span for a SQL statement sent to system, the
+// db.system name of the database, e.g. "postgresql". Queries are
+// parameterized, so the statement text is recorded as is.
+func StartQuery(ctx context.Context, system, query string) (context.Context, trace.Span) {
+	statement := strings.Join(strings.Fields(query), " ")
+	operation, target := sqlOperation(statement)
+
+	return Tracer().Start(ctx, sqlSpanName(system, operation, target),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String(system),
+			semconv.DBQueryText(statement),
+			semconv.DBOperationName(operation),
+			attribute.String("db.collection.name", target),
+		),
+	)
+}
+
+// sqlOperation returns the statement's leading keyword and the first table
+// it names, e.g. ("SELECT", "users").
+func sqlOperation(statement string) (string, string) {
+	operation, _, _ := strings.Cut(statement, " ")
+	operation = strings.ToUpper(operation)
+
+	var target string
+	if match := sqlTarget.FindStringSubmatch(statement); match != nil {
+		target = strings.ToLower(match[1])
+	}
+	return operation, target
+}
+
+func sqlSpanName(system, operation, target string) string {
+	switch {
+	case operation == "":
+		return system
+	case target == "":
+		return operation
+	default:
+		return operation + " " + target
+	}
+}
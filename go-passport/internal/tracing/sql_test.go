@@ -0,0 +1,26 @@
+package tracing
+
+import "testing"
+
+func TestSQLOperation(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      string
+	}{
+		{"SELECT id, email_address FROM users WHERE id = $1", "SELECT users"},
+		{"select count(*) from sessions where user_id = $1", "SELECT sessions"},
+		{"INSERT INTO sessions (user_id) VALUES ($1) RETURNING id", "INSERT sessions"},
+		{"UPDATE users SET role = $1 WHERE id = $2", "UPDATE users"},
+		{"DELETE FROM rate_limits WHERE tat < now()", "DELETE rate_limits"},
+		{"CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT)", "CREATE schema_migrations"},
+		{"SELECT pg_notify($1, $2)", "SELECT"},
+		{"", "sqlite"},
+	}
+
+	for _, tt := range tests {
+		operation, target := sqlOperation(tt.statement)
+		if got := sqlSpanName("sqlite", operation, target); got != tt.want {
+			t.Errorf("span name for %q = %q, want %q", tt.statement, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+type DeviceType string
+
+const (
+	DeviceDesktop DeviceType = "desktop"
+	DeviceMobile  DeviceType = "mobile"
+	DeviceTablet  DeviceType = "tablet"
+	DeviceBot     DeviceType = "bot"
+	DeviceUnknown DeviceType = "unknown"
+)
+
+// Info is the human readable summary of a User-Agent header.
+type Info struct {
+	Browser    string
+	OS         string
+	DeviceType DeviceType
+}
+
+type browserRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// Order matters: most Chromium based browsers also advertise Chrome and
+// Safari, so the more specific tokens must be checked first.
+var browserRules = []browserRule{
+	{"Edge", regexp.MustCompile(`(?:Edg|EdgA|EdgiOS)/(\d+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/(\d+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/(\d+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)},
+	{"Safari", regexp.MustCompile(`Version/(\d+)(?:\.\d+)*.*Safari/`)},
+	{"curl", regexp.MustCompile(`^curl/(\d+)`)},
+}
+
+var (
+	windowsPattern = regexp.MustCompile(`Windows NT (\d+\.\d+)`)
+	iosPattern     = regexp.MustCompile(`(?:iPhone|CPU) OS (\d+)`)
+	androidPattern = regexp.MustCompile(`Android (\d+)`)
+	macPattern     = regexp.MustCompile(`Mac OS X (\d+)[_.](\d+)`)
+	botPattern     = regexp.MustCompile(`(?i)bot|crawler|spider|slurp|facebookexternalhit`)
+)
+
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+}
+
+// Parse extracts the browser, operating system and device type from a
+// User-Agent header. Unrecognised values are reported as "Unknown".
+func Parse(ua string) Info {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return Info{Browser: "Unknown", OS: "Unknown", DeviceType: DeviceUnknown}
+	}
+
+	return Info{
+		Browser:    parseBrowser(ua),
+		OS:         parseOS(ua),
+		DeviceType: parseDeviceType(ua),
+	}
+}
+
+func parseBrowser(ua string) string {
+	for _, rule := range browserRules {
+		if m := rule.pattern.FindStringSubmatch(ua); m != nil {
+			return rule.name + " " + m[1]
+		}
+	}
+	return "Unknown"
+}
+
+func parseOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPad"):
+		if m := iosPattern.FindStringSubmatch(ua); m != nil {
+			return "iPadOS " + m[1]
+		}
+		return "iPadOS"
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		if m := iosPattern.FindStringSubmatch(ua); m != nil {
+			return "iOS " + m[1]
+		}
+		return "iOS"
+	case strings.Contains(ua, "Android"):
+		if m := androidPattern.FindStringSubmatch(ua); m != nil {
+			return "Android " + m[1]
+		}
+		return "Android"
+	case strings.Contains(ua, "Windows"):
+		if m := windowsPattern.FindStringSubmatch(ua); m != nil {
+			if version, ok := windowsVersions[m[1]]; ok {
+				return "Windows " + version
+			}
+		}
+		return "Windows"
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(ua, "Macintosh") || strings.Contains(ua, "Mac OS X"):
+		if m := macPattern.FindStringSubmatch(ua); m != nil {
+			return "macOS " + m[1] + "." + m[2]
+		}
+		return "macOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	}
+	return "Unknown"
+}
+
+func parseDeviceType(ua string) DeviceType {
+	switch {
+	case botPattern.MatchString(ua):
+		return DeviceBot
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		return DeviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		return DeviceMobile
+	case strings.HasPrefix(ua, "Mozilla/"):
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}
@@ -0,0 +1,55 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			name: "chrome on macos",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: Info{Browser: "Chrome 120", OS: "macOS 10.15", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "edge on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			want: Info{Browser: "Edge 120", OS: "Windows 10", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "safari on iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Safari 17", OS: "iOS 17", DeviceType: DeviceMobile},
+		},
+		{
+			name: "firefox on android tablet",
+			ua:   "Mozilla/5.0 (Android 14; Tablet; rv:121.0) Gecko/121.0 Firefox/121.0",
+			want: Info{Browser: "Firefox 121", OS: "Android 14", DeviceType: DeviceTablet},
+		},
+		{
+			name: "crawler",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{Browser: "Unknown", OS: "Unknown", DeviceType: DeviceBot},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.4.0",
+			want: Info{Browser: "curl 8", OS: "Unknown", DeviceType: DeviceUnknown},
+		},
+		{
+			name: "empty",
+			ua:   "",
+			want: Info{Browser: "Unknown", OS: "Unknown", DeviceType: DeviceUnknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.ua); got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+			}
+		})
+	}
+}
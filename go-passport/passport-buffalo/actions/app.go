@@ -94,9 +94,10 @@ func App() *buffalo.App {
 			var result int
 			err := models.DB.RawQuery("SELECT 1").All(&result)
 			if err != nil {
+				// Driver errors can include hosts and credentials; keep them in the logs
+				c.Logger().Errorf("health check failed: %v", err)
 				return c.Render(503, r.JSON(map[string]string{
 					"status": "unhealthy",
-					"error":  err.Error(),
 				}))
 			}
 			